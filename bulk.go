@@ -0,0 +1,170 @@
+//
+// hiiragi :: bulk.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hattya/go.cli"
+)
+
+const bulkSize = 500
+
+type bulk struct {
+	info    []any
+	file    []any
+	symlink []any
+	// inserted rows
+	n map[string]int64
+}
+
+func (b *bulk) len() int {
+	return len(b.info) / 5
+}
+
+func (db *DB) BeginBulk() error {
+	s := db.scope()
+	switch {
+	case s == nil:
+		return errors.New("bulk requires a transaction")
+	case s.bulk != nil:
+		return nil
+	}
+	for _, t := range []string{"file", "symlink"} {
+		for _, e := range []string{"insert", "delete"} {
+			if _, err := s.tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %v_%v", t, e)); err != nil {
+				return err
+			}
+		}
+	}
+	// triggers are restored by EndBulk
+	s.bulk = &bulk{n: make(map[string]int64)}
+	return nil
+}
+
+// FlushBulk writes the buffered entries and updates the counters. Triggers
+// are not restored until EndBulk.
+func (db *DB) FlushBulk() error {
+	s := db.scope()
+	if s == nil || s.bulk == nil {
+		return nil
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	for _, t := range []string{"file", "symlink"} {
+		if s.bulk.n[t] == 0 {
+			continue
+		}
+		if _, err := s.tx.Exec(`UPDATE master SET total = total + ? WHERE type = ?`, s.bulk.n[t], t); err != nil {
+			return err
+		}
+		s.bulk.n[t] = 0
+	}
+	return nil
+}
+
+func (db *DB) EndBulk() error {
+	s := db.scope()
+	if s == nil || s.bulk == nil {
+		return nil
+	}
+	if err := db.FlushBulk(); err != nil {
+		return err
+	}
+	s.bulk = nil
+	for _, q := range triggers {
+		if _, err := s.tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) buffer(path string, dev, ino, nlink uint64, mtime time.Time, v any) error {
+	b := db.scope().bulk
+	b.info = append(b.info, dev, ino, nlink, mtime, path)
+	if _, ok := v.(string); !ok {
+		b.file = append(b.file, path, v)
+	} else {
+		b.symlink = append(b.symlink, path, v)
+	}
+	if b.len() < bulkSize {
+		return nil
+	}
+	return db.flush()
+}
+
+func (db *DB) flush() error {
+	s := db.scope()
+	b := s.bulk
+	if b.len() == 0 {
+		return nil
+	}
+	// paths which are already in the cache are ignored
+	q := cli.Dedent(`
+		INSERT OR IGNORE INTO info (
+		         dev,
+		         ino,
+		         nlink,
+		         mtime,
+		         path
+		       )
+		VALUES
+	`) + values(b.len(), 5)
+	if _, err := s.tx.Exec(q, b.info...); err != nil {
+		return err
+	}
+	for _, e := range []struct {
+		t, col string
+		a      []any
+	}{
+		{"file", "size", b.file},
+		{"symlink", "target", b.symlink},
+	} {
+		if len(e.a) == 0 {
+			continue
+		}
+		q := fmt.Sprintf(cli.Dedent(`
+			INSERT OR IGNORE INTO %v (
+			         info_id,
+			         %v
+			       )
+			SELECT i.id,
+			       v.column2
+			  FROM (
+			         VALUES
+			         %v
+			       ) AS v
+			       INNER JOIN info AS i
+			          ON i.path = v.column1
+		`), e.t, e.col, values(len(e.a)/2, 2))
+		res, err := s.tx.Exec(q, e.a...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		b.n[e.t] += n
+	}
+	b.info = b.info[:0]
+	b.file = b.file[:0]
+	b.symlink = b.symlink[:0]
+	return nil
+}
+
+func values(rows, cols int) string {
+	row := "(" + strings.Repeat("?, ", cols-1) + "?)"
+	return strings.Repeat(row+", ", rows-1) + row
+}
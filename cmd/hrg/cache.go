@@ -0,0 +1,193 @@
+//
+// hiiragi/cmd/hrg :: cache.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func cacheCmd(ctx *cli.Context) error {
+	if len(ctx.Args) == 0 {
+		return errors.New("no cache command specified")
+	}
+	switch ctx.Args[0] {
+	case "list":
+		ctx.Args = ctx.Args[1:]
+		return cacheList(ctx)
+	case "rm":
+		ctx.Args = ctx.Args[1:]
+		return cacheRm(ctx)
+	}
+	return fmt.Errorf("unknown cache command '%v'", ctx.Args[0])
+}
+
+func cacheList(ctx *cli.Context) error {
+	if len(ctx.Args) != 0 {
+		return errors.New("too many arguments")
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	list, err := filepath.Glob(filepath.Join(dir, "*.db"))
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		fi, err := os.Stat(c)
+		if err != nil {
+			return err
+		}
+		si, err := hiiragi.ReadScanInfo(c)
+		if err != nil {
+			return err
+		}
+		ctx.UI.Printf("%v  %10d  %v\n", strings.TrimSuffix(filepath.Base(c), ".db"), fi.Size(), fi.ModTime().Format(time.DateTime))
+		if si != nil {
+			for _, r := range si.Roots {
+				ctx.UI.Println("  root:", r.Path)
+			}
+		}
+	}
+	return nil
+}
+
+func cacheRm(ctx *cli.Context) error {
+	if len(ctx.Args) == 0 {
+		return errors.New("no cache specified")
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	for _, a := range ctx.Args {
+		// key or root
+		k := strings.TrimSuffix(a, ".db")
+		if fi, err := os.Stat(a); err == nil && fi.IsDir() {
+			p, err := filepath.Abs(a)
+			if err != nil {
+				return err
+			}
+			k = cacheKey([]string{p})
+		}
+		c := filepath.Join(dir, k+".db")
+		if _, err := os.Lstat(c); err != nil {
+			return err
+		}
+		if err := removeCache(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cache(ctx *cli.Context, prof *profile, roots []string) (string, bool, error) {
+	return findCache(ctx.String("cache"), prof, roots)
+}
+
+func findCache(c string, prof *profile, roots []string) (string, bool, error) {
+	if c == defaultCache && prof.Cache != "" {
+		c = prof.Cache
+	}
+	var dir string
+	if c != defaultCache {
+		if fi, err := os.Stat(c); err != nil || !fi.IsDir() {
+			return c, false, nil
+		}
+		// directory of the cache
+		dir = c
+	}
+	if len(roots) == 0 {
+		if len(prof.Roots) == 0 {
+			return "", false, errors.New("no cache specified")
+		}
+		for _, r := range prof.Roots {
+			p, err := filepath.Abs(r.Path)
+			if err != nil {
+				return "", false, err
+			}
+			roots = append(roots, p)
+		}
+	}
+	if dir == "" {
+		var err error
+		if dir, err = cacheDir(); err != nil {
+			return "", false, err
+		}
+		if err := os.MkdirAll(dir, 0o777); err != nil {
+			return "", false, err
+		}
+	}
+	return filepath.Join(dir, cacheKey(roots)+".db"), true, nil
+}
+
+// interrupted reports whether the scan or dedup with the cache was
+// interrupted.
+func interrupted(c string) (bool, error) {
+	db, err := hiiragi.Open(c)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	switch si, err := db.ScanInfo(); {
+	case err != nil:
+		return false, err
+	case si != nil && !si.Done():
+		return true, nil
+	}
+	in, err := db.Intent()
+	return in != nil, err
+}
+
+func absRoots(args []string) ([]string, error) {
+	var roots []string
+	for _, a := range args {
+		p, err := filepath.Abs(a)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, p)
+	}
+	return roots, nil
+}
+
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hiiragi"), nil
+}
+
+func cacheKey(roots []string) string {
+	roots = slices.Compact(slices.Sorted(slices.Values(roots)))
+	h := sha256.Sum256([]byte(strings.Join(roots, "\n")))
+	return hex.EncodeToString(h[:8])
+}
+
+func removeCache(c string) error {
+	for _, s := range []string{"-wal", "-shm"} {
+		if err := os.Remove(c + s); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Remove(c)
+}
@@ -0,0 +1,111 @@
+//
+// hiiragi/cmd/hrg :: cache_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hattya/hiiragi"
+)
+
+func TestFindCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir()
+	key := filepath.Join(dir, cacheKey([]string{path})+".db")
+	// directory of the cache
+	cdir := t.TempDir()
+	ckey := filepath.Join(cdir, cacheKey([]string{path})+".db")
+
+	for _, tt := range []struct {
+		c     string
+		prof  *profile
+		roots []string
+		cache string
+		auto  bool
+	}{
+		{"hiiragi.db", new(profile), []string{path}, "hiiragi.db", false},
+		{"", &profile{Cache: "hiiragi.db"}, []string{path}, "hiiragi.db", false},
+		{"", new(profile), []string{path}, key, true},
+		{"", &profile{Roots: []*root{{Path: path}}}, nil, key, true},
+		{cdir, new(profile), []string{path}, ckey, true},
+		{cdir, &profile{Roots: []*root{{Path: path}}}, nil, ckey, true},
+		{"", &profile{Cache: cdir}, []string{path}, ckey, true},
+	} {
+		c, auto, err := findCache(tt.c, tt.prof, tt.roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := c, tt.cache; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+		if g, e := auto, tt.auto; g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+	// keyed by the roots
+	a, _, err := findCache(cdir, new(profile), []string{filepath.Join(path, "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := findCache(cdir, new(profile), []string{filepath.Join(path, "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("expected different caches, got %v", a)
+	}
+	// no roots
+	for _, c := range []string{"", cdir} {
+		if _, _, err := findCache(c, new(profile), nil); err == nil {
+			t.Error("expected error")
+		}
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	for _, tt := range []struct {
+		si *hiiragi.ScanInfo
+		in *hiiragi.Intent
+		ok bool
+	}{
+		{nil, nil, false},
+		{&hiiragi.ScanInfo{Roots: []*hiiragi.ScanRoot{{Path: "a", Done: true}}}, nil, false},
+		{&hiiragi.ScanInfo{Roots: []*hiiragi.ScanRoot{{Path: "a"}}}, nil, true},
+		{&hiiragi.ScanInfo{Roots: []*hiiragi.ScanRoot{{Path: "a", Done: true}}}, &hiiragi.Intent{PID: 1}, true},
+	} {
+		c := filepath.Join(t.TempDir(), "hiiragi.db")
+		db, err := hiiragi.Create(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.si != nil {
+			if err := db.SetScanInfo(tt.si); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.in != nil {
+			if err := db.SetIntent(tt.in); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+
+		switch ok, err := interrupted(c); {
+		case err != nil:
+			t.Fatal(err)
+		case ok != tt.ok:
+			t.Errorf("expected %v, got %v", tt.ok, ok)
+		}
+	}
+}
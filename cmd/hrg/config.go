@@ -0,0 +1,280 @@
+//
+// hiiragi/cmd/hrg :: config.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hattya/hiiragi"
+)
+
+type config struct {
+	Profiles map[string]*profile `toml:"profile"`
+}
+
+type profile struct {
+	Attrs          *bool    `toml:"attrs"`
+	Xattrs         *bool    `toml:"xattrs"`
+	IgnoreXattrs   []string `toml:"ignore-xattrs"`
+	Name           *bool    `toml:"name"`
+	KeepDirTimes   *bool    `toml:"keep-dir-times"`
+	Mtime          string   `toml:"mtime"`
+	KeepMtime      string   `toml:"keep-mtime"`
+	KeepAtime      string   `toml:"keep-atime"`
+	Link           string   `toml:"link"`
+	Granularity    string   `toml:"granularity"`
+	SymlinkTargets string   `toml:"symlink-targets"`
+	Cache          string   `toml:"cache"`
+	CacheSize      *int64   `toml:"cache-size"`
+	MinSize        int64    `toml:"min-size"`
+	MaxSize        int64    `toml:"max-size"`
+	Jobs           int      `toml:"jobs"`
+	Exclude        []string `toml:"exclude"`
+	Roots          []*root  `toml:"root"`
+}
+
+type root struct {
+	Path    string   `toml:"path"`
+	Exclude []string `toml:"exclude"`
+}
+
+func loadConfig(name, prof string) (*profile, error) {
+	var cfg config
+	if name != "" {
+		if _, err := toml.DecodeFile(name, &cfg); err != nil {
+			return nil, err
+		}
+	} else if dir, err := os.UserConfigDir(); err == nil {
+		// optional
+		if _, err := toml.DecodeFile(filepath.Join(dir, "hiiragi", "config.toml"), &cfg); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	p, ok := cfg.Profiles[prof]
+	switch {
+	case ok:
+	case prof == "default":
+		p = new(profile)
+	default:
+		return nil, fmt.Errorf("unknown profile '%v'", prof)
+	}
+	// validate
+	if _, err := p.when(); err != nil {
+		return nil, err
+	}
+	if _, err := p.keepMtime(); err != nil {
+		return nil, err
+	}
+	if _, err := p.keepAtime(); err != nil {
+		return nil, err
+	}
+	if _, ok := granularity[p.Granularity]; !ok && p.Granularity != "" {
+		return nil, fmt.Errorf(`invalid granularity '%v': must be one of "ns", "us", "ms", "s" or "fat"`, p.Granularity)
+	}
+	if _, ok := strategy[p.Link]; !ok && p.Link != "" {
+		return nil, fmt.Errorf(`invalid link '%v': must be one of "hard", "absolute" or "relative"`, p.Link)
+	}
+	if _, ok := symlinkTargets[p.SymlinkTargets]; !ok && p.SymlinkTargets != "" {
+		return nil, fmt.Errorf(`invalid symlink-targets '%v': must be one of "exact", "clean" or "resolve"`, p.SymlinkTargets)
+	}
+	p.Cache = expand(p.Cache)
+	for _, r := range p.Roots {
+		r.Path = expand(r.Path)
+		if !filepath.IsAbs(r.Path) {
+			return nil, fmt.Errorf("profile '%v': root must be an absolute path: '%v'", prof, r.Path)
+		}
+		r.Path = filepath.Clean(r.Path)
+	}
+	return p, nil
+}
+
+var granularity = map[string]any{
+	"ns":  time.Nanosecond,
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"fat": 2 * time.Second,
+}
+
+var keep = map[string]any{
+	"oldest": hiiragi.Oldest,
+	"latest": hiiragi.Latest,
+	"source": hiiragi.When(0),
+}
+
+var strategy = map[string]any{
+	"hard":     hiiragi.HardLink,
+	"absolute": hiiragi.AbsSymlink,
+	"relative": hiiragi.RelSymlink,
+}
+
+var symlinkTargets = map[string]any{
+	"exact":   hiiragi.Normalize(0),
+	"clean":   hiiragi.Clean,
+	"resolve": hiiragi.Resolve,
+}
+
+type options struct {
+	size         int64
+	attrs        bool
+	xattrs       bool
+	ignore       []string
+	name         bool
+	keepDirTimes bool
+	keepAtime    hiiragi.When
+	mtime        hiiragi.When
+	keepMtime    hiiragi.When
+	link         hiiragi.Strategy
+	gran         time.Duration
+	norm         hiiragi.Normalize
+	jobs         int
+	minSize      int64
+	maxSize      int64
+}
+
+// merge returns the options of the profile overridden by the flags which are
+// specified on the command line.
+func (p *profile) merge(flags map[string]any) *options {
+	o := &options{
+		size:    defaultCacheSize,
+		attrs:   true,
+		ignore:  p.IgnoreXattrs,
+		name:    true,
+		gran:    time.Second,
+		jobs:    1,
+		minSize: p.MinSize,
+		maxSize: p.MaxSize,
+	}
+	if p.CacheSize != nil {
+		o.size = *p.CacheSize
+	}
+	for _, b := range []struct {
+		v *bool
+		p *bool
+	}{
+		{&o.attrs, p.Attrs},
+		{&o.xattrs, p.Xattrs},
+		{&o.name, p.Name},
+		{&o.keepDirTimes, p.KeepDirTimes},
+	} {
+		if b.p != nil {
+			*b.v = *b.p
+		}
+	}
+	o.mtime, _ = p.when()
+	o.keepMtime, _ = p.keepMtime()
+	o.keepAtime, _ = p.keepAtime()
+	if p.Link != "" {
+		o.link = strategy[p.Link].(hiiragi.Strategy)
+	}
+	if p.Granularity != "" {
+		o.gran = granularity[p.Granularity].(time.Duration)
+	}
+	if p.SymlinkTargets != "" {
+		o.norm = symlinkTargets[p.SymlinkTargets].(hiiragi.Normalize)
+	}
+	if p.Jobs != 0 {
+		o.jobs = p.Jobs
+	}
+
+	for k, v := range flags {
+		switch k {
+		case "size":
+			o.size = v.(int64)
+		case "attrs":
+			o.attrs = v.(bool)
+		case "xattrs":
+			o.xattrs = v.(bool)
+		case "ignore-xattrs":
+			o.ignore = v.([]string)
+		case "name":
+			o.name = v.(bool)
+		case "keep-dir-times":
+			o.keepDirTimes = v.(bool)
+		case "keep-atime":
+			o.keepAtime = v.(hiiragi.When)
+		case "mtime":
+			o.mtime = v.(hiiragi.When)
+		case "keep-mtime":
+			o.keepMtime = v.(hiiragi.When)
+		case "link":
+			o.link = v.(hiiragi.Strategy)
+		case "granularity":
+			o.gran = v.(time.Duration)
+		case "symlink-targets":
+			o.norm = v.(hiiragi.Normalize)
+		case "jobs":
+			o.jobs = v.(int)
+		case "min-size":
+			o.minSize = v.(int64)
+		case "max-size":
+			o.maxSize = v.(int64)
+		}
+	}
+	return o
+}
+
+func (p *profile) when() (hiiragi.When, error) {
+	switch strings.ToLower(p.Mtime) {
+	case "", "none":
+		return 0, nil
+	case "oldest":
+		return hiiragi.Oldest, nil
+	case "latest":
+		return hiiragi.Latest, nil
+	}
+	return 0, fmt.Errorf(`invalid mtime '%v': must be one of "oldest", "latest" or "none"`, p.Mtime)
+}
+
+func (p *profile) keepMtime() (hiiragi.When, error) {
+	return keepWhen("keep-mtime", p.KeepMtime)
+}
+
+func (p *profile) keepAtime() (hiiragi.When, error) {
+	return keepWhen("keep-atime", p.KeepAtime)
+}
+
+func keepWhen(k, v string) (hiiragi.When, error) {
+	switch strings.ToLower(v) {
+	case "", "source":
+		return 0, nil
+	case "oldest":
+		return hiiragi.Oldest, nil
+	case "latest":
+		return hiiragi.Latest, nil
+	}
+	return 0, fmt.Errorf(`invalid %v '%v': must be one of "oldest", "latest" or "source"`, k, v)
+}
+
+func (p *profile) exclude(path string) []string {
+	list := p.Exclude
+	for _, r := range p.Roots {
+		if r.Path == path {
+			list = append(list[:len(list):len(list)], r.Exclude...)
+		}
+	}
+	return list
+}
+
+func expand(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,166 @@
+//
+// hiiragi/cmd/hrg :: config_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hattya/hiiragi"
+)
+
+const configTOML = `
+[profile.backup]
+attrs           = false
+xattrs          = true
+ignore-xattrs   = ["user.checksum"]
+keep-dir-times  = true
+mtime           = "oldest"
+keep-mtime      = "latest"
+keep-atime      = "oldest"
+link            = "relative"
+granularity     = "fat"
+symlink-targets = "resolve"
+cache-size      = -2000
+min-size        = 4096
+max-size        = 8192
+jobs            = 8
+exclude         = ["*.tmp"]
+
+[[profile.backup.root]]
+path    = "~/backup"
+exclude = ["lost+found"]
+`
+
+func TestLoadConfig(t *testing.T) {
+	name := writeConfig(t, configTOML)
+	p, err := loadConfig(name, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(p.Roots), 1; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := p.Roots[0].Path, filepath.Join(home, "backup"); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := p.exclude(p.Roots[0].Path), []string{"*.tmp", "lost+found"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// default
+	if _, err := loadConfig(name, "default"); err != nil {
+		t.Error(err)
+	}
+	// unknown
+	if _, err := loadConfig(name, "unknown"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestLoadConfigError(t *testing.T) {
+	for _, s := range []string{
+		`mtime = "none?"`,
+		`keep-mtime = "never"`,
+		`keep-atime = "always"`,
+		`granularity = "min"`,
+		`link = "soft"`,
+		`symlink-targets = "real"`,
+		`[[profile.default.root]]
+		path = "srv"`,
+		`attrs = "yes"`,
+	} {
+		if _, err := loadConfig(writeConfig(t, "[profile.default]\n"+s), "default"); err == nil {
+			t.Errorf("expected error: %v", s)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	p, err := loadConfig(writeConfig(t, configTOML), "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// profile
+	g := p.merge(nil)
+	e := &options{
+		size:         -2000,
+		attrs:        false,
+		xattrs:       true,
+		ignore:       []string{"user.checksum"},
+		name:         true,
+		keepDirTimes: true,
+		keepAtime:    hiiragi.Oldest,
+		mtime:        hiiragi.Oldest,
+		keepMtime:    hiiragi.Latest,
+		link:         hiiragi.RelSymlink,
+		gran:         2 * time.Second,
+		norm:         hiiragi.Resolve,
+		jobs:         8,
+		minSize:      4096,
+		maxSize:      8192,
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %+v, got %+v", e, g)
+	}
+	// flags which equal the defaults
+	g = p.merge(map[string]any{
+		"size":            defaultCacheSize,
+		"attrs":           true,
+		"xattrs":          false,
+		"ignore-xattrs":   []string{"security"},
+		"name":            false,
+		"keep-dir-times":  false,
+		"keep-atime":      hiiragi.When(0),
+		"mtime":           hiiragi.When(0),
+		"keep-mtime":      hiiragi.When(0),
+		"link":            hiiragi.HardLink,
+		"granularity":     time.Second,
+		"symlink-targets": hiiragi.Normalize(0),
+		"jobs":            1,
+		"min-size":        int64(0),
+		"max-size":        int64(0),
+	})
+	e = &options{
+		size:   defaultCacheSize,
+		attrs:  true,
+		ignore: []string{"security"},
+		gran:   time.Second,
+		jobs:   1,
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %+v, got %+v", e, g)
+	}
+	// defaults
+	g = new(profile).merge(nil)
+	e = &options{
+		size:  defaultCacheSize,
+		attrs: true,
+		name:  true,
+		gran:  time.Second,
+		jobs:  1,
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %+v, got %+v", e, g)
+	}
+}
+
+func writeConfig(t *testing.T, s string) string {
+	name := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(name, []byte(s), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
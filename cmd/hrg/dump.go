@@ -0,0 +1,85 @@
+//
+// hiiragi/cmd/hrg :: dump.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func export(ctx *cli.Context) error {
+	if len(ctx.Args) > 1 {
+		return errors.New("too many arguments")
+	}
+	prof, err := loadConfig(ctx.String("config"), ctx.String("profile"))
+	if err != nil {
+		return err
+	}
+	c, _, err := cache(ctx, prof, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(c); err != nil {
+		return err
+	}
+	db, err := hiiragi.Open(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = ctx.UI.Stdout
+	if len(ctx.Args) == 1 && ctx.Args[0] != "-" {
+		f, err := os.Create(ctx.Args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return db.Dump(ctx.Context(), w)
+}
+
+func import_(ctx *cli.Context) error {
+	if len(ctx.Args) > 1 {
+		return errors.New("too many arguments")
+	}
+	prof, err := loadConfig(ctx.String("config"), ctx.String("profile"))
+	if err != nil {
+		return err
+	}
+	c, _, err := cache(ctx, prof, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(c); err == nil {
+		return fmt.Errorf("'%v' already exists!", c)
+	}
+
+	var r io.Reader = ctx.UI.Stdin
+	if len(ctx.Args) == 1 && ctx.Args[0] != "-" {
+		f, err := os.Open(ctx.Args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	db, err := hiiragi.Create(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Load(ctx.Context(), r)
+}
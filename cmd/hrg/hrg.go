@@ -15,6 +15,8 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/hattya/go.cli"
 	"github.com/hattya/hiiragi"
@@ -23,7 +25,12 @@ import (
 	"golang.org/x/term"
 )
 
-var app = cli.NewCLI()
+var (
+	app = cli.NewCLI()
+
+	defaultCache     = ""
+	defaultCacheSize int64
+)
 
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
@@ -45,30 +52,192 @@ func init() {
 		panic(err)
 	}
 
+	defaultCacheSize = -int64(mem.Total / 2 / 1024)
+
 	app.Version = hiiragi.Version
-	app.Usage = "[options] PATH"
+	app.Usage = []string{
+		"[options] [PATH...]",
+		"[options] cache list",
+		"[options] cache rm KEY|PATH...",
+		"[options] export [FILE]",
+		"[options] import [FILE]",
+		"[options] scan [PATH...]",
+		"[options] stats [PATH...]",
+	}
 	app.Desc = "Create hard links for duplicate files that are under the specified directory."
 	app.Flags.Bool("a, attrs", false, "ignore file attributes")
-	app.Flags.String("c, cache", "hiiragi.db", "cache file (default: %q)")
-	app.Flags.PrefixChoice("m, mtime", hiiragi.When(0), map[string]any{
+	app.Flags.String("c, cache", defaultCache, "cache file, or directory of the cache (default: hiiragi/<key>.db under the user cache directory)")
+	app.Flags.String("config", "", "config file (default: hiiragi/config.toml under the user config directory)")
+	app.Flags.MetaVar("config", " <file>")
+	app.Flags.Bool("compare-attrs", false, "compare file attributes even if the profile ignores them")
+	app.Flags.Bool("compare-name", false, "compare file name even if the profile ignores it")
+	app.Flags.Bool("cross-device", false, "report duplicate files across devices instead of linking")
+	app.Flags.PrefixChoice("g, granularity", nil, granularity, `mtime granularity. <unit> is one of "ns", "us", "ms", "s" or "fat" (default: "s")`)
+	app.Flags.MetaVar("granularity", " <unit>")
+	app.Flags.String("ignore-xattrs", "", "comma-separated list of xattr namespaces to ignore")
+	app.Flags.MetaVar("ignore-xattrs", " <list>")
+	app.Flags.Int("j, jobs", 0, "number of goroutines to walk directories (default: 1)")
+	app.Flags.MetaVar("jobs", " <n>")
+	app.Flags.PrefixChoice("keep-atime", nil, keep, `atime of the merged inode. <when> is one of "oldest", "latest" or "source" (default: "source")`)
+	app.Flags.MetaVar("keep-atime", " <when>")
+	app.Flags.Bool("keep-dir-times", false, "restore mtimes of parent directories after linking")
+	app.Flags.PrefixChoice("keep-mtime", nil, keep, `mtime of the merged inode. <when> is one of "oldest", "latest" or "source" (default: "source")`)
+	app.Flags.MetaVar("keep-mtime", " <when>")
+	app.Flags.PrefixChoice("link", nil, strategy, `link strategy. <type> is one of "hard", "absolute" or "relative" (default: "hard")`)
+	app.Flags.MetaVar("link", " <type>")
+	app.Flags.Int("log-every", 0, "log progress every <n> files when stdout is not a terminal")
+	app.Flags.MetaVar("log-every", " <n>")
+	app.Flags.Int("log-interval", 60, "log progress every <n> seconds when stdout is not a terminal (default: %v)")
+	app.Flags.MetaVar("log-interval", " <n>")
+	app.Flags.Int64("max-size", -1, "ignore files larger than <n> bytes (default: no limit)")
+	app.Flags.MetaVar("max-size", " <n>")
+	app.Flags.Int64("min-size", -1, "ignore files smaller than <n> bytes (default: 0)")
+	app.Flags.MetaVar("min-size", " <n>")
+	app.Flags.PrefixChoice("m, mtime", nil, map[string]any{
 		"oldest": hiiragi.Oldest,
 		"latest": hiiragi.Latest,
-	}, `ignore mtime. <when> is either "oldest" or "latest"`)
+		"none":   hiiragi.When(0),
+	}, `ignore mtime. <when> is one of "oldest", "latest" or "none" (default: "none")`)
 	app.Flags.MetaVar("mtime", " <when>")
 	app.Flags.Bool("n, name", false, "ignore file name")
+	app.Flags.Bool("no-keep-dir-times", false, "do not restore mtimes of parent directories even if the profile does")
+	app.Flags.Bool("no-xattrs", false, "do not compare extended attributes even if the profile does")
 	app.Flags.Bool("p, pretend", false, "show what will be done")
+	app.Flags.String("P, profile", "default", "profile in the config file (default: %q)")
+	app.Flags.MetaVar("profile", " <name>")
 	app.Flags.Bool("r, resume", false, "resume dedup with the specified cache file")
-	app.Flags.Int64("s, size", -int64(mem.Total/2/1024), "cache size for SQLite (default: 50%% of system memory)")
-	app.Action = cli.Simple(dedup)
+	app.Flags.Int64("s, size", 0, "cache size for SQLite (default: 50%% of system memory)")
+	app.Flags.PrefixChoice("symlink-targets", nil, symlinkTargets, `normalization of symlink targets. <mode> is one of "exact", "clean" or "resolve" (default: "exact")`)
+	app.Flags.MetaVar("symlink-targets", " <mode>")
+	app.Flags.Bool("t, trees", false, "report duplicate directory trees instead of linking")
+	app.Flags.Bool("x, xattrs", false, "compare extended attributes and ACLs")
+	app.Action = cli.Simple(run)
 	app.Stdout = colorable.NewColorable(os.Stdout)
 	app.Stderr = colorable.NewColorable(os.Stderr)
 }
 
+var commands = map[string]func(*cli.Context) error{
+	"cache":  cacheCmd,
+	"export": export,
+	"import": import_,
+	"scan":   scan,
+	"stats":  stats,
+}
+
+func run(ctx *cli.Context) error {
+	if len(ctx.Args) > 0 {
+		if fn, ok := commands[ctx.Args[0]]; ok {
+			ctx.Args = ctx.Args[1:]
+			return fn(ctx)
+		}
+	}
+	return dedup(ctx)
+}
+
 func dedup(ctx *cli.Context) error {
-	progress := false
+	return process(ctx, false)
+}
+
+func scan(ctx *cli.Context) error {
+	return process(ctx, true)
+}
+
+// specified returns the flags which are specified on the command line.
+func specified(ctx *cli.Context) (map[string]any, error) {
+	flags := make(map[string]any)
+	if v := ctx.Int64("size"); v != 0 {
+		flags["size"] = v
+	}
+	for _, b := range []struct {
+		name, on, off string
+	}{
+		{"attrs", "compare-attrs", "attrs"},
+		{"xattrs", "xattrs", "no-xattrs"},
+		{"name", "compare-name", "name"},
+		{"keep-dir-times", "keep-dir-times", "no-keep-dir-times"},
+	} {
+		switch on, off := ctx.Bool(b.on), ctx.Bool(b.off); {
+		case on && off:
+			return nil, cli.FlagError(fmt.Sprintf("--%v and --%v are mutually exclusive", b.on, b.off))
+		case on || off:
+			flags[b.name] = on
+		}
+	}
+	if v := ctx.String("ignore-xattrs"); v != "" {
+		flags["ignore-xattrs"] = strings.Split(v, ",")
+	}
+	for _, k := range []string{"mtime", "keep-mtime", "keep-atime", "link", "granularity", "symlink-targets"} {
+		if v := ctx.Value(k); v != nil {
+			flags[k] = v
+		}
+	}
+	if v := ctx.Int("jobs"); 0 < v {
+		flags["jobs"] = v
+	}
+	for _, k := range []string{"min-size", "max-size"} {
+		if v := ctx.Int64(k); 0 <= v {
+			flags[k] = v
+		}
+	}
+	return flags, nil
+}
+
+func process(ctx *cli.Context, scanOnly bool) error {
+	prof, err := loadConfig(ctx.String("config"), ctx.String("profile"))
+	if err != nil {
+		return err
+	}
+	flags, err := specified(ctx)
+	if err != nil {
+		return err
+	}
+	// command-line flags override the profile
+	o := prof.merge(flags)
+	roots := ctx.Args
+	if len(roots) == 0 {
+		for _, r := range prof.Roots {
+			roots = append(roots, r.Path)
+		}
+	}
+	si := &hiiragi.ScanInfo{
+		MinSize: o.minSize,
+		MaxSize: o.maxSize,
+		Options: map[string]string{
+			"attrs":           fmt.Sprint(o.attrs),
+			"xattrs":          fmt.Sprint(o.xattrs),
+			"ignore-xattrs":   strings.Join(o.ignore, ","),
+			"name":            fmt.Sprint(o.name),
+			"mtime":           o.mtime.String(),
+			"granularity":     o.gran.String(),
+			"symlink-targets": o.norm.String(),
+		},
+	}
+	for _, p := range roots {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		si.Roots = append(si.Roots, &hiiragi.ScanRoot{
+			Path:    p,
+			Exclude: prof.exclude(p),
+		})
+	}
+	var paths []string
+	for _, r := range si.Roots {
+		paths = append(paths, r.Path)
+	}
+	c, auto, err := cache(ctx, prof, paths)
+	if err != nil {
+		return err
+	}
+
+	t := hiiragi.NewTerminal(ctx.UI)
+	t.Progress = false
 	if f, ok := ctx.UI.Stdout.(*os.File); ok {
-		progress = term.IsTerminal(int(f.Fd()))
+		t.Progress = term.IsTerminal(int(f.Fd()))
 	}
+	t.LogInterval = time.Duration(ctx.Int("log-interval")) * time.Second
+	t.LogEvery = int64(ctx.Int("log-every"))
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
@@ -77,38 +246,105 @@ func dedup(ctx *cli.Context) error {
 		ctx.Interrupt()
 	}()
 
-	c := ctx.String("cache")
+	resume := ctx.Bool("resume")
 	open := hiiragi.Create
-	if ctx.Bool("resume") {
+	if resume {
 		open = hiiragi.Open
-	} else {
-		if _, err := os.Lstat(c); err == nil {
+	} else if _, err := os.Lstat(c); err == nil {
+		if !auto {
 			return fmt.Errorf("'%v' already exists!", c)
 		}
+		// resume the interrupted run, or rescan
+		if resume, err = interrupted(c); err != nil {
+			return err
+		} else if resume {
+			open = hiiragi.Open
+		} else if err := removeCache(c); err != nil {
+			return err
+		}
 	}
 	db, err := open(c)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
-	if err := db.SetCacheSize(ctx.Int64("size")); err != nil {
+	if err := db.SetCacheSize(o.size); err != nil {
 		return err
 	}
+	db.SetGranularity(o.gran)
+	db.SetNormalization(o.norm)
+	db.SetCrossDevice(o.link != hiiragi.HardLink)
 
-	if !ctx.Bool("resume") {
-		f := hiiragi.NewFinder(ctx.UI, db)
-		f.Progress = progress
-		for _, p := range ctx.Args {
-			p, err := filepath.Abs(p)
-			if err != nil {
-				return err
+	var prev *hiiragi.ScanInfo
+	if resume {
+		if prev, err = db.ScanInfo(); err != nil {
+			return err
+		} else if prev == nil {
+			ctx.UI.Errorf("warning: '%v' has no scan information\n", c)
+		} else {
+			for _, d := range prev.Diff(si) {
+				ctx.UI.Errorln("warning: differs from the original scan:", d)
+			}
+			// follow the original granularity
+			if v, ok := prev.Options["granularity"]; ok {
+				if o.gran, err = time.ParseDuration(v); err != nil {
+					return err
+				}
+				db.SetGranularity(o.gran)
 			}
-			if err := f.Walk(ctx.Context(), p); err != nil {
+		}
+	}
+	if !resume || (prev != nil && !prev.Done()) {
+		f := hiiragi.NewFinder(t, db)
+		f.MinSize = o.minSize
+		f.MaxSize = o.maxSize
+		f.Workers = o.jobs
+		// bulk insertion keeps stale rows
+		f.Bulk = !resume
+		f.Options = si.Options
+		if prev != nil {
+			// continue the original scan
+			f.MinSize = prev.MinSize
+			f.MaxSize = prev.MaxSize
+			f.Options = prev.Options
+			f.Resume(prev)
+			si = prev
+		}
+		for _, r := range si.Roots {
+			f.Exclude = r.Exclude
+			if err := f.Walk(ctx.Context(), r.Path); err != nil {
 				return err
 			}
 		}
 		f.Close()
 	}
+	if scanOnly {
+		return nil
+	}
+
+	if ctx.Bool("trees") {
+		tf := hiiragi.NewTreeFinder(t, db)
+		list, err := tf.Find(ctx.Context())
+		if err != nil {
+			return err
+		}
+		for _, dt := range list {
+			ctx.UI.Println(dt)
+		}
+		return nil
+	}
+
+	if ctx.Bool("cross-device") {
+		xf := hiiragi.NewCrossDevFinder(t, db)
+		list, err := xf.Find(ctx.Context())
+		if err != nil {
+			return err
+		}
+		for _, d := range list {
+			ctx.UI.Println(d)
+		}
+		return nil
+	}
 
 	if ctx.Bool("pretend") {
 		// close master
@@ -116,7 +352,7 @@ func dedup(ctx *cli.Context) error {
 			return err
 		}
 		// copy master → temporary
-		f, err := os.Open(ctx.String("cache"))
+		f, err := os.Open(c)
 		if err != nil {
 			return err
 		}
@@ -135,16 +371,28 @@ func dedup(ctx *cli.Context) error {
 			return err
 		}
 		defer db.Close()
-		if err := db.SetCacheSize(ctx.Int64("size")); err != nil {
+		if err := db.SetCacheSize(o.size); err != nil {
 			return err
 		}
+		db.SetGranularity(o.gran)
+		db.SetNormalization(o.norm)
+		db.SetCrossDevice(o.link != hiiragi.HardLink)
 	}
 
-	d := hiiragi.NewDeduper(ctx.UI, db)
-	d.Attrs = !ctx.Bool("attrs")
-	d.Mtime = ctx.Value("mtime").(hiiragi.When)
-	d.Name = !ctx.Bool("name")
+	d := hiiragi.NewDeduper(t, db)
+	d.Attrs = o.attrs
+	d.Xattrs = o.xattrs
+	d.IgnoreXattrs = o.ignore
+	d.Mtime = o.mtime
+	d.KeepMtime = o.keepMtime
+	d.KeepAtime = o.keepAtime
+	d.Name = o.name
+	d.KeepDirTimes = o.keepDirTimes
+	d.Strategy = o.link
 	d.Pretend = ctx.Bool("pretend")
-	d.Progress = progress
-	return d.All(ctx.Context())
+	if err := d.All(ctx.Context()); err != nil {
+		return err
+	}
+	ctx.UI.Println(d.Summary())
+	return nil
 }
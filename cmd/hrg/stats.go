@@ -0,0 +1,57 @@
+//
+// hiiragi/cmd/hrg :: stats.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func stats(ctx *cli.Context) error {
+	prof, err := loadConfig(ctx.String("config"), ctx.String("profile"))
+	if err != nil {
+		return err
+	}
+	roots, err := absRoots(ctx.Args)
+	if err != nil {
+		return err
+	}
+	c, _, err := cache(ctx, prof, roots)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(c); err != nil {
+		return err
+	}
+	db, err := hiiragi.Open(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	si, err := db.ScanInfo()
+	if err != nil {
+		return err
+	}
+	st, err := db.Stats(ctx.Context())
+	if err != nil {
+		return err
+	}
+	if si != nil {
+		ctx.UI.Printf("scanned by hrg %v from %v to %v\n", si.Version, si.Start.Format(time.DateTime), si.End.Format(time.DateTime))
+		for _, r := range si.Roots {
+			ctx.UI.Println("root:", r.Path)
+		}
+	}
+	ctx.UI.Println(st)
+	return nil
+}
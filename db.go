@@ -1,7 +1,7 @@
 //
 // hiiragi :: db.go
 //
-//   Copyright (c) 2016-2025 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -21,13 +21,17 @@ import (
 	"time"
 
 	"github.com/hattya/go.cli"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
+	name  string
 	db    *sql.DB
 	stmt  map[string]*sql.Stmt
 	stack []*scope
+	gran  time.Duration
+	norm  Normalize
+	xdev  bool
 }
 
 func Create(name string) (*DB, error) {
@@ -43,9 +47,11 @@ func Open(name string) (*DB, error) {
 		return nil, err
 	}
 	return &DB{
+		name:  name,
 		db:    db,
 		stmt:  make(map[string]*sql.Stmt),
 		stack: nil,
+		gran:  time.Second,
 	}, nil
 }
 
@@ -53,11 +59,52 @@ func (db *DB) Close() error {
 	return db.db.Close()
 }
 
+func (db *DB) Name() string {
+	return db.name
+}
+
 func (db *DB) SetCacheSize(size int64) error {
 	_, err := db.db.Exec(fmt.Sprintf(`PRAGMA cache_size = %v`, size))
 	return err
 }
 
+func (db *DB) Granularity() time.Duration {
+	return db.gran
+}
+
+func (db *DB) SetGranularity(d time.Duration) {
+	db.gran = max(d, time.Nanosecond)
+}
+
+func (db *DB) Normalization() Normalize {
+	return db.norm
+}
+
+func (db *DB) SetNormalization(n Normalize) {
+	db.norm = n
+}
+
+func (db *DB) CrossDevice() bool {
+	return db.xdev
+}
+
+func (db *DB) SetCrossDevice(b bool) {
+	db.xdev = b
+}
+
+func (db *DB) target(path, t string) string {
+	switch db.norm {
+	case Clean:
+		return filepath.Clean(t)
+	case Resolve:
+		if !filepath.IsAbs(t) {
+			t = filepath.Join(filepath.Dir(path), t)
+		}
+		return filepath.Clean(t)
+	}
+	return t
+}
+
 func (db *DB) Begin() error {
 	tx, err := db.db.Begin()
 	db.stack = append(db.stack, &scope{
@@ -119,6 +166,47 @@ func (db *DB) count(t string) (done, n int64, err error) {
 	return
 }
 
+func (db *DB) FileSize(mtime bool) (size int64, err error) {
+	k := "FileSize"
+	if mtime {
+		k += ".mtime"
+	}
+	if db.xdev {
+		k += ".xdev"
+	}
+	stmt, ok := db.stmt[k]
+	if !ok {
+		by := "f.size"
+		if !db.xdev {
+			by += ", i.dev"
+		}
+		if mtime {
+			by += ", mtime_bucket(i.mtime, ?)"
+		}
+		q := fmt.Sprintf(cli.Dedent(`
+			SELECT COALESCE(SUM(size), 0)
+			  FROM (
+			         SELECT SUM(f.size) AS size,
+			                COUNT(*)    AS n
+			           FROM file AS f
+			                INNER JOIN info AS i
+			                   ON f.info_id = i.id
+			          GROUP BY %v
+			       )
+			 WHERE 1 < n
+		`), by)
+		if stmt, err = db.prepare(k, q); err != nil {
+			return
+		}
+	}
+	var args []any
+	if mtime {
+		args = append(args, int64(db.gran))
+	}
+	err = stmt.QueryRow(args...).Scan(&size)
+	return
+}
+
 func (db *DB) NextFiles(ctx context.Context, mtime bool, order Order) ([]*File, error) {
 	list, err := db.next(ctx, new(File), mtime, order)
 	return list.([]*File), err
@@ -135,10 +223,15 @@ func (db *DB) next(ctx context.Context, t any, mtime bool, order Order) (list an
 	lv := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(tt)), 0, 0)
 	list = lv.Interface() // make type assertion simple
 
+	// symlinks are always hard-linked
+	xdev := db.xdev && tt.Name() == "File"
 	k := "next." + tt.Name()
 	if mtime {
 		k += ".mtime"
 	}
+	if xdev {
+		k += ".xdev"
+	}
 	stmt, ok := db.stmt[k]
 	if !ok {
 		var b bytes.Buffer
@@ -158,6 +251,7 @@ func (db *DB) next(ctx context.Context, t any, mtime bool, order Order) (list an
 			       )
 			SELECT i.path,
 			       i.dev,
+			       i.ino,
 			       i.nlink,
 			       i.mtime,
 			       %[1]v
@@ -166,24 +260,79 @@ func (db *DB) next(ctx context.Context, t any, mtime bool, order Order) (list an
 			          ON info_id = i.id,
 			       next AS n
 			 WHERE %[1]v   =  n.value
-			   AND i.dev   =  n.dev
 		`), strings.ToLower(col), strings.ToLower(tt.Name()))
+		if !xdev {
+			b.WriteString(cli.Dedent(`
+			   AND i.dev   =  n.dev
+			`))
+		}
 		if mtime {
 			b.WriteString(cli.Dedent(`
-			   AND i.mtime =  n.mtime
+			   AND mtime_bucket(i.mtime, ?1) = mtime_bucket(n.mtime, ?1)
 			`))
 		}
 		if stmt, err = db.prepare(k, b.String()); err != nil {
 			return
 		}
 	}
-	rows, err := stmt.QueryContext(ctx)
+	var args []any
+	if mtime {
+		args = append(args, int64(db.gran))
+	}
+	if list, err = db.query(ctx, stmt, tt, args...); err != nil {
+		return
+	}
+	sortEntries(list, order)
+	return
+}
+
+func (db *DB) ListFiles(ctx context.Context) ([]*File, error) {
+	list, err := db.list(ctx, new(File))
+	return list.([]*File), err
+}
+
+func (db *DB) ListSymlinks(ctx context.Context) ([]*Symlink, error) {
+	list, err := db.list(ctx, new(Symlink))
+	return list.([]*Symlink), err
+}
+
+func (db *DB) list(ctx context.Context, t any) (list any, err error) {
+	tt := reflect.Indirect(reflect.ValueOf(t)).Type()
+	col := tt.Field(tt.NumField() - 1).Name
+	list = reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(tt)), 0, 0).Interface()
+
+	k := "list." + tt.Name()
+	stmt, ok := db.stmt[k]
+	if !ok {
+		q := fmt.Sprintf(cli.Dedent(`
+			SELECT i.path,
+			       i.dev,
+			       i.ino,
+			       i.nlink,
+			       i.mtime,
+			       %v
+			  FROM %v
+			       INNER JOIN info AS i
+			          ON info_id = i.id
+			 ORDER BY i.path
+		`), strings.ToLower(col), strings.ToLower(tt.Name()))
+		if stmt, err = db.prepare(k, q); err != nil {
+			return
+		}
+	}
+	return db.query(ctx, stmt, tt)
+}
+
+func (db *DB) query(ctx context.Context, stmt *sql.Stmt, tt reflect.Type, args ...any) (list any, err error) {
+	lv := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(tt)), 0, 0)
+	list = lv.Interface()
+
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 
-	lv = reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(tt)), 0, 0)
 	for rows.Next() {
 		v := reflect.New(tt).Elem()
 		dst := make([]any, tt.NumField())
@@ -197,7 +346,6 @@ func (db *DB) next(ctx context.Context, t any, mtime bool, order Order) (list an
 	}
 	list = lv.Interface()
 	err = rows.Err()
-	sortEntries(list, order)
 	return
 }
 
@@ -236,16 +384,38 @@ func (db *DB) Done(path string) error {
 	})
 }
 
-func (db *DB) Update(fi FileInfoEx) error {
+func (db *DB) Update(fsys FS, fi FileInfoEx) error {
 	dev, err := fi.Dev()
 	if err != nil {
 		return err
 	}
+	ino, err := fi.Ino()
+	if err != nil {
+		return err
+	}
 	nlink, err := fi.Nlink()
 	if err != nil {
 		return err
 	}
+	var v any
+	if fi.Mode()&os.ModeType == 0 {
+		// file
+		v = fi.Size()
+	} else {
+		// symlink
+		t, err := fsys.Readlink(fi.Path())
+		if err != nil {
+			return err
+		}
+		v = db.target(fi.Path(), t)
+	}
+	return db.update(fi.Path(), dev, ino, nlink, fi.ModTime(), v)
+}
 
+func (db *DB) update(path string, dev, ino, nlink uint64, mtime time.Time, v any) error {
+	if s := db.scope(); s != nil && s.bulk != nil {
+		return db.buffer(path, dev, ino, nlink, mtime, v)
+	}
 	return db.withTx(func() (err error) {
 		s := db.scope()
 		i := "Update.INSERT.info"
@@ -253,6 +423,7 @@ func (db *DB) Update(fi FileInfoEx) error {
 			q := cli.Dedent(`
 				INSERT INTO info (
 				         dev,
+				         ino,
 				         nlink,
 				         mtime,
 				         path
@@ -261,6 +432,7 @@ func (db *DB) Update(fi FileInfoEx) error {
 				         ?,
 				         ?,
 				         ?,
+				         ?,
 				         ?
 				       )
 			`)
@@ -273,6 +445,7 @@ func (db *DB) Update(fi FileInfoEx) error {
 			q := cli.Dedent(`
 				UPDATE info
 				   SET dev   = ?,
+				       ino   = ?,
 				       nlink = ?,
 				       mtime = ?
 				 WHERE path = ?
@@ -281,25 +454,19 @@ func (db *DB) Update(fi FileInfoEx) error {
 				return
 			}
 		}
-		if err = db.upsert(i, u, dev, nlink, fi.ModTime(), fi.Path()); err != nil {
+		if err = db.upsert(i, u, dev, ino, nlink, mtime, path); err != nil {
 			return
 		}
 
 		var t, col string
-		a := make([]any, 2)
-		a[1] = fi.Path()
-		if fi.Mode()&os.ModeType == 0 {
+		if _, ok := v.(string); !ok {
 			// file
 			t = "file"
 			col = "size"
-			a[0] = fi.Size()
 		} else {
 			// symlink
 			t = "symlink"
 			col = "target"
-			if a[0], err = os.Readlink(fi.Path()); err != nil {
-				return
-			}
 		}
 		i = "Update.INSERT." + t
 		if _, ok := s.stmt[i]; !ok {
@@ -332,7 +499,7 @@ func (db *DB) Update(fi FileInfoEx) error {
 				return
 			}
 		}
-		return db.upsert(i, u, a...)
+		return db.upsert(i, u, v, path)
 	})
 }
 
@@ -377,6 +544,7 @@ func (db *DB) withTx(fn func() error) (err error) {
 type scope struct {
 	tx   *sql.Tx
 	stmt map[string]*sql.Stmt
+	bulk *bulk
 }
 
 func (s *scope) prepare(name, query string) (*sql.Stmt, error) {
@@ -390,6 +558,7 @@ func (s *scope) prepare(name, query string) (*sql.Stmt, error) {
 type File struct {
 	Path  string
 	Dev   uint64
+	Ino   uint64
 	Nlink uint64
 	Mtime time.Time
 	Size  int64
@@ -398,6 +567,7 @@ type File struct {
 type Symlink struct {
 	Path   string
 	Dev    uint64
+	Ino    uint64
 	Nlink  uint64
 	Mtime  time.Time
 	Target string
@@ -469,11 +639,51 @@ const (
 	Desc
 )
 
+type Normalize uint
+
+const (
+	Clean Normalize = 1 + iota
+	Resolve
+)
+
+func (n Normalize) String() string {
+	switch n {
+	case 0:
+		return "None"
+	case Clean:
+		return "Clean"
+	case Resolve:
+		return "Resolve"
+	}
+	return fmt.Sprintf("Normalize(%d)", n)
+}
+
 var (
 	pragma   map[string]string
 	table    map[string][]string
 	index    map[string][][]string
 	triggers []string
+
+	// migrations[i] upgrades the schema from version i to i + 1
+	migrations = []func(*sql.Tx) error{
+		// 0 → 1: user_version
+		func(*sql.Tx) error { return nil },
+		// 1 → 2: meta
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(createTable("meta"))
+			return err
+		},
+		// 2 → 3: info.ino
+		func(tx *sql.Tx) error {
+			var n int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('info') WHERE name = 'ino'`).Scan(&n); err != nil || n > 0 {
+				return err
+			}
+			_, err := tx.Exec(`ALTER TABLE info ADD COLUMN ino INTEGER NOT NULL DEFAULT 0`)
+			return err
+		},
+	}
+	schemaVersion = len(migrations)
 )
 
 func init() {
@@ -491,6 +701,7 @@ func init() {
 		"id      INTEGER   NOT NULL PRIMARY KEY",
 		"path    TEXT      NOT NULL UNIQUE",
 		"dev     INTEGER   NOT NULL CHECK (0 < dev)",
+		"ino     INTEGER   NOT NULL DEFAULT 0",
 		"nlink   INTEGER   NOT NULL CHECK (0 < nlink) DEFAULT 1",
 		"mtime   TIMESTAMP NOT NULL",
 	}
@@ -511,10 +722,15 @@ func init() {
 		"done    INTEGER NOT NULL CHECK (0 <= done)  DEFAULT 0",
 		"total   INTEGER NOT NULL CHECK (0 <= total) DEFAULT 0",
 	}
+	table["meta"] = []string{
+		"key     TEXT    NOT NULL PRIMARY KEY",
+		"value   TEXT    NOT NULL",
+	}
 
 	index = make(map[string][][]string)
 	index["info"] = [][]string{
 		{"dev", "mtime"},
+		{"dev", "ino"},
 	}
 	index["file"] = [][]string{
 		{"info_id", "size"},
@@ -556,8 +772,27 @@ func init() {
 	}
 }
 
+func init() {
+	sql.Register("hiiragi", &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			return c.RegisterFunc("mtime_bucket", mtimeBucket, true)
+		},
+	})
+}
+
+// mtimeBucket returns the bucket of the mtime by the granularity. Entries in
+// the same bucket have the same mtime.
+func mtimeBucket(mtime string, gran int64) (int64, error) {
+	// format of go-sqlite3
+	t, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", mtime)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano() / gran, nil
+}
+
 func open(name string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", name)
+	db, err := sql.Open("hiiragi", name)
 	if err != nil {
 		return nil, err
 	}
@@ -577,8 +812,13 @@ func open(name string) (*sql.DB, error) {
 		}
 	}
 
-	for k, v := range table {
-		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (\n  %v\n)", k, strings.Join(v, ",\n  "))); err != nil {
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+
+	for k := range table {
+		if _, err := db.Exec(createTable(k)); err != nil {
 			db.Close()
 			return nil, fmt.Errorf("CREATE TABLE %v: %v", k, err)
 		}
@@ -614,6 +854,52 @@ func open(name string) (*sql.DB, error) {
 			return nil, err
 		}
 	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %v", schemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return db, tx.Commit()
 }
+
+func createTable(name string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (\n  %v\n)", name, strings.Join(table[name], ",\n  "))
+}
+
+func migrate(db *sql.DB) error {
+	var v, n int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&v); err != nil {
+		return err
+	}
+	switch {
+	case schemaVersion < v:
+		return fmt.Errorf("cache schema version %v is newer than %v", v, schemaVersion)
+	case v == schemaVersion:
+		return nil
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'info'").Scan(&n); err != nil {
+		return err
+	} else if n == 0 {
+		// new cache
+		return nil
+	}
+
+	for ; v < schemaVersion; v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[v](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate schema version %v: %w", v, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %v", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 //
 // hiiragi :: db_test.go
 //
-//   Copyright (c) 2016-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -10,13 +10,17 @@ package hiiragi_test
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hattya/go.cli"
 	"github.com/hattya/hiiragi"
 )
 
@@ -84,6 +88,117 @@ func TestDBOpen(t *testing.T) {
 	}
 }
 
+func TestDBSchema(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hiiragi.db")
+	db, err := hiiragi.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	version := func() int {
+		t.Helper()
+
+		db, err := sql.Open("sqlite3", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		var v int
+		if err := db.QueryRow("PRAGMA user_version").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	setVersion := func(v int) {
+		t.Helper()
+
+		db, err := sql.Open("sqlite3", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %v", v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if g, e := version(), hiiragi.SchemaVersion; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// migrate
+	setVersion(0)
+	if db, err = hiiragi.Open(name); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if g, e := version(), hiiragi.SchemaVersion; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// newer
+	setVersion(hiiragi.SchemaVersion + 1)
+	if _, err := hiiragi.Open(name); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestReadScanInfo(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hiiragi#1.db")
+	db, err := hiiragi.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si, err := hiiragi.ReadScanInfo(name); err != nil {
+		t.Fatal(err)
+	} else if si != nil {
+		t.Errorf("expected nil, got %v", si)
+	}
+	if err := db.SetScanInfo(&hiiragi.ScanInfo{
+		Version: hiiragi.Version,
+		Roots:   []*hiiragi.ScanRoot{{Path: "root"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// newer schema
+	sdb, err := sql.Open("sqlite3", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+	if _, err := sdb.Exec(fmt.Sprintf("PRAGMA user_version = %v", hiiragi.SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := hiiragi.ReadScanInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(si.Roots), 1; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	if g, e := si.Roots[0].Path, "root"; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	var v int
+	if err := sdb.QueryRow("PRAGMA user_version").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := v, hiiragi.SchemaVersion+1; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// not exist
+	if _, err := hiiragi.ReadScanInfo(filepath.Join(t.TempDir(), "hiiragi.db")); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func TestDBCacheSize(t *testing.T) {
 	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
 	if err != nil {
@@ -100,6 +215,58 @@ func TestDBCacheSize(t *testing.T) {
 	}
 }
 
+func TestDBGranularity(t *testing.T) {
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if g, e := db.Granularity(), time.Second; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	db.SetGranularity(time.Millisecond)
+	if g, e := db.Granularity(), time.Millisecond; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	db.SetGranularity(0)
+	if g, e := db.Granularity(), time.Nanosecond; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+
+	// same buckets
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	mtime := time.Now().Truncate(time.Minute)
+	for i, d := range []time.Duration{12100 * time.Millisecond, 13900 * time.Millisecond, 11900 * time.Millisecond} {
+		n := filepath.Join(root, fmt.Sprint(i))
+		if err := m.WriteFile(n, []byte("data\n"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Chtimes(n, time.Time{}, mtime.Add(d)); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := m.Lstat(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Update(m, fi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.SetGranularity(2 * time.Second)
+	if size, err := db.FileSize(true); err != nil {
+		t.Fatal(err)
+	} else if g, e := size, int64(10); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if list, err := db.NextFiles(context.Background(), true, hiiragi.Asc); err != nil {
+		t.Fatal(err)
+	} else if g, e := len(list), 2; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
 func TestDBFiles(t *testing.T) {
 	dir := t.TempDir()
 	db, err := hiiragi.Create(filepath.Join(dir, "hiiragi.db"))
@@ -181,6 +348,52 @@ func TestDBFiles(t *testing.T) {
 	}
 }
 
+func TestDBFileSize(t *testing.T) {
+	dir := t.TempDir()
+	db, err := hiiragi.Create(filepath.Join(dir, "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root := filepath.Join(dir, "root")
+	if err := mkdir(root); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for i, data := range []string{"data\n", "data\n", "hiiragi\n"} {
+		n := filepath.Join(root, fmt.Sprint(i+1))
+		if err := file(n, data); err != nil {
+			t.Fatal(err)
+		}
+		ts := now
+		if i == 1 {
+			ts = now.Add(-3 * time.Second)
+		}
+		if err := lutimes(n, ts, ts); err != nil {
+			t.Fatal(err)
+		}
+		if err := update(db, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		mtime bool
+		size  int64
+	}{
+		{true, 0},
+		{false, 10},
+	} {
+		switch size, err := db.FileSize(tt.mtime); {
+		case err != nil:
+			t.Fatal(err)
+		case size != tt.size:
+			t.Errorf("expected %v, got %v", tt.size, size)
+		}
+	}
+}
+
 func TestDBSymlinks(t *testing.T) {
 	if !supportsSymlinks {
 		t.Skipf("skipping on %v", runtime.GOOS)
@@ -378,7 +591,7 @@ func update(db *hiiragi.DB, path string) error {
 	if err != nil {
 		return err
 	}
-	return db.Update(fi)
+	return db.Update(hiiragi.OSFS{}, fi)
 }
 
 var home string
@@ -532,3 +745,160 @@ func TestSortSymlinks(t *testing.T) {
 		}
 	}
 }
+
+func TestDBStats(t *testing.T) {
+	m, files := createMemFiles(t)
+	if err := m.WriteFile(filepath.Join(string(filepath.Separator), "root", "2"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Symlink("1", filepath.Join(string(filepath.Separator), "root", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove(files[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Link(files[0], files[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	if err := f.Walk(ctx, filepath.Join(string(filepath.Separator), "root")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	st, err := db.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := st.Files, int64(4); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Symlinks, int64(1); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := len(st.Devices), 1; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	if g, e := *st.Devices[0], (hiiragi.DevStats{Dev: 1, Files: 4, Symlinks: 1}); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Sizes[0].Files, int64(1); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Sizes[1].Files, int64(3); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Groups, int64(1); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Savable, int64(10); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Shared, int64(2); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Linked, int64(2); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Saved, int64(5); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := st.Partial, int64(1); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if !strings.Contains(st.String(), "size collisions: 1 groups, 15 B, 10 B savable") {
+		t.Errorf("unexpected output: %q", st)
+	}
+	if !strings.Contains(st.String(), "hard links: 2 entries, 5 B saved, ratio 1.50") {
+		t.Errorf("unexpected output: %q", st)
+	}
+	if !strings.Contains(st.String(), "partially linked: 1 groups of the same size") {
+		t.Errorf("unexpected output: %q", st)
+	}
+}
+
+func TestDBBulk(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for i := range 1234 {
+		if err := m.WriteFile(filepath.Join(root, fmt.Sprint(i%10), fmt.Sprint(i)), []byte(fmt.Sprint(i%7)), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 10 {
+		if err := m.Symlink("0", filepath.Join(root, fmt.Sprint(i), "l")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var dump []string
+	for _, bulk := range []bool{false, true} {
+		db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.FS = m
+		f.Bulk = bulk
+		f.CommitEvery = 100
+		// overlapped
+		for _, p := range []string{root, filepath.Join(root, "0")} {
+			if err := f.Walk(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+		if err := count(db, 1244); err != nil {
+			t.Errorf("%v (bulk = %v)", err, bulk)
+		}
+		var b strings.Builder
+		if err := db.Dump(ctx, &b); err != nil {
+			t.Fatal(err)
+		}
+		dump = append(dump, b.String())
+
+		// triggers
+		fi, err := m.Lstat(filepath.Join(root, "0", "l"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Update(m, fi); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Done(filepath.Join(root, "0", "0")); err != nil {
+			t.Fatal(err)
+		}
+		if done, n, err := db.NumFiles(); err != nil {
+			t.Fatal(err)
+		} else if done != 1 || n != 1234 {
+			t.Errorf("expected 1 / 1234, got %v / %v (bulk = %v)", done, n, bulk)
+		}
+	}
+	if dump[0] != dump[1] {
+		t.Error("expected same entries")
+	}
+}
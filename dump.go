@@ -0,0 +1,116 @@
+//
+// hiiragi :: dump.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type Record struct {
+	Type   string    `json:"type"`
+	Path   string    `json:"path"`
+	Dev    uint64    `json:"dev"`
+	Ino    uint64    `json:"ino,omitempty"`
+	Nlink  uint64    `json:"nlink"`
+	Mtime  time.Time `json:"mtime"`
+	Size   *int64    `json:"size,omitempty"`
+	Target *string   `json:"target,omitempty"`
+}
+
+func (db *DB) Dump(ctx context.Context, w io.Writer) error {
+	files, err := db.ListFiles(ctx)
+	if err != nil {
+		return err
+	}
+	syms, err := db.ListSymlinks(ctx)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, f := range files {
+		if err := enc.Encode(&Record{
+			Type:  "file",
+			Path:  f.Path,
+			Dev:   f.Dev,
+			Ino:   f.Ino,
+			Nlink: f.Nlink,
+			Mtime: f.Mtime,
+			Size:  &f.Size,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, s := range syms {
+		if err := enc.Encode(&Record{
+			Type:   "symlink",
+			Path:   s.Path,
+			Dev:    s.Dev,
+			Ino:    s.Ino,
+			Nlink:  s.Nlink,
+			Mtime:  s.Mtime,
+			Target: &s.Target,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) Load(ctx context.Context, r io.Reader) error {
+	if err := db.Begin(); err != nil {
+		return err
+	}
+	defer db.Rollback()
+
+	if err := db.BeginBulk(); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for n := 1; ; n++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		var rec Record
+		switch err := dec.Decode(&rec); {
+		case err == io.EOF:
+			if err := db.EndBulk(); err != nil {
+				return err
+			}
+			return db.Commit()
+		case err != nil:
+			return fmt.Errorf("record %v: %w", n, err)
+		}
+		var v any
+		switch {
+		case rec.Path == "":
+			return fmt.Errorf("record %v: path is empty", n)
+		case rec.Dev == 0:
+			return fmt.Errorf("record %v: dev must be greater than 0", n)
+		case rec.Type == "file" && rec.Size != nil:
+			v = *rec.Size
+		case rec.Type == "symlink" && rec.Target != nil:
+			v = *rec.Target
+		default:
+			return fmt.Errorf("record %v: invalid %v record", n, rec.Type)
+		}
+		if err := db.update(rec.Path, rec.Dev, rec.Ino, max(rec.Nlink, 1), rec.Mtime, v); err != nil {
+			return fmt.Errorf("record %v: %w", n, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+//
+// hiiragi :: dump_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func TestDumpLoad(t *testing.T) {
+	m, _ := createMemFiles(t)
+	if err := m.Symlink("1", filepath.Join(string(filepath.Separator), "root", "2")); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	db, err := hiiragi.Create(filepath.Join(dir, "1.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	if err := f.Walk(ctx, filepath.Join(string(filepath.Separator), "root")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var b1 strings.Builder
+	if err := db.Dump(ctx, &b1); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := strings.Count(b1.String(), "\n"), 4; g != e {
+		t.Errorf("expected %v records, got %v", e, g)
+	}
+
+	db2, err := hiiragi.Create(filepath.Join(dir, "2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if err := db2.Load(ctx, strings.NewReader(b1.String())); err != nil {
+		t.Fatal(err)
+	}
+	var b2 strings.Builder
+	if err := db2.Dump(ctx, &b2); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := b2.String(), b1.String(); g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	if _, n, err := db2.NumFiles(); err != nil {
+		t.Fatal(err)
+	} else if g, e := n, int64(3); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+
+	for _, s := range []string{
+		`{"type":"file","path":"/a","dev":1,"mtime":"2026-01-01T00:00:00Z"}`,
+		`{"type":"symlink","path":"/a","dev":1,"mtime":"2026-01-01T00:00:00Z","size":1}`,
+		`{"type":"file","path":"","dev":1,"mtime":"2026-01-01T00:00:00Z","size":1}`,
+		`{"type":"file","path":"/a","dev":0,"mtime":"2026-01-01T00:00:00Z","size":1}`,
+		`{`,
+	} {
+		db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Load(ctx, strings.NewReader(s)); err == nil {
+			t.Errorf("expected error: %v", s)
+		}
+		db.Close()
+	}
+}
@@ -1,7 +1,7 @@
 //
 // hiiragi :: export_test.go
 //
-//   Copyright (c) 2016-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,6 +9,7 @@
 package hiiragi
 
 var (
-	NewCounter = newCounter
-	Sort       = sortEntries
+	NewCounter    = newCounter
+	Sort          = sortEntries
+	SchemaVersion = schemaVersion
 )
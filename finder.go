@@ -1,7 +1,7 @@
 //
 // hiiragi :: finder.go
 //
-//   Copyright (c) 2016-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -13,28 +13,61 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-
-	"github.com/hattya/go.cli"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Finder struct {
-	Progress bool
+	FS      FS
+	Exclude []string
+	MinSize int64
+	MaxSize int64
+	Workers int
+	Bulk    bool
+	Options map[string]string
+
+	CommitEvery    int64
+	CommitInterval time.Duration
+
+	obs    Observer
+	db     *DB
+	p      *counter
+	info   *ScanInfo
+	root   *ScanRoot
+	marker []string
+	last   string
+	n      int64
+	t      time.Time
+	cache  []FileInfoEx
+	pid    string
+	tmp    map[string]bool
 
-	ui *cli.CLI
-	db *DB
-	p  *counter
+	// subtrees of the parallel walker
+	mu      sync.Mutex
+	tops    []string
+	pending map[string]int
 }
 
-func NewFinder(ui *cli.CLI, db *DB) *Finder {
+func NewFinder(obs Observer, db *DB) *Finder {
 	f := &Finder{
-		Progress: true,
-		ui:       ui,
-		db:       db,
-		p:        newCounter(ui, "scan"),
+		FS:             OSFS{},
+		CommitEvery:    100000,
+		CommitInterval: time.Minute,
+		obs:            obs,
+		db:             db,
+		p:              newCounter(obs, "scan"),
 	}
 	return f
 }
 
+func (f *Finder) Resume(si *ScanInfo) {
+	f.info = si
+}
+
 func (f *Finder) Close() {
 	f.p.Update(0)
 	f.p.Close()
@@ -46,46 +79,479 @@ func (f *Finder) Walk(ctx context.Context, root string) error {
 	}
 	defer f.db.Rollback()
 
-	f.p.Show = f.Progress
-	err := filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+	if f.Bulk {
+		if err := f.db.BeginBulk(); err != nil {
+			return err
+		}
+	}
+	if f.info == nil {
+		f.info = &ScanInfo{
+			Version: Version,
+			Start:   time.Now(),
+		}
+	}
+	f.root = nil
+	f.marker = nil
+	for _, r := range f.info.Roots {
+		if r.Path == root {
+			if r.Done {
+				return nil
+			}
+			// resume
+			f.root = r
+			if r.Last != "" {
+				f.marker = split(r.Last)
+			}
+		}
+	}
+	if f.root == nil {
+		f.root = &ScanRoot{Path: root}
+		f.info.Roots = append(f.info.Roots, f.root)
+	}
+	f.root.Exclude = f.Exclude
+	f.info.MinSize = f.MinSize
+	f.info.MaxSize = f.MaxSize
+	f.info.Options = f.Options
+	f.last = ""
+	f.n = 0
+	f.t = time.Now()
+	// cache files
+	f.cache = f.cache[:0]
+	if name := f.db.Name(); name != "" && name != ":memory:" {
+		for _, s := range []string{"", "-wal", "-shm", "-journal"} {
+			if fi, err := Stat(name + s); err == nil {
+				f.cache = append(f.cache, fi)
+			}
+		}
+	}
+
+	// temporary files of the interrupted Deduper
+	f.tmp = nil
+	if in, err := f.db.Intent(); err != nil {
+		return err
+	} else if in != nil {
+		f.pid = strconv.Itoa(in.PID)
+		f.tmp = make(map[string]bool)
+		for _, p := range in.Paths {
+			f.tmp[p] = true
+		}
+	}
+
+	var err error
+	if f.Workers > 1 {
+		err = f.walkParallel(ctx, root)
+	} else {
+		err = f.walk(ctx, root)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.root.Done = true
+	f.root.Last = ""
+	if err := f.db.EndBulk(); err != nil {
+		return err
+	}
+	return f.commit()
+}
+
+func (f *Finder) commit() error {
+	// triggers are restored when the walk is done
+	if err := f.db.FlushBulk(); err != nil {
+		return err
+	}
+	f.info.End = time.Now()
+	if err := f.db.SetScanInfo(f.info); err != nil {
+		return err
+	}
+	return f.db.Commit()
+}
+
+func (f *Finder) checkpoint() error {
+	f.n++
+	if (f.CommitEvery <= 0 || f.n < f.CommitEvery) && (f.CommitInterval <= 0 || time.Since(f.t) < f.CommitInterval) {
+		return nil
+	}
+	if f.Workers <= 1 {
+		// entries are committed in walk order
+		f.root.Last = f.last
+	} else if last := f.completed(); last != "" {
+		f.root.Last = last
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	if err := f.db.Begin(); err != nil {
+		return err
+	}
+	if f.Bulk {
+		if err := f.db.BeginBulk(); err != nil {
+			return err
+		}
+	}
+	f.n = 0
+	f.t = time.Now()
+	return nil
+}
+
+func (f *Finder) done(path string) bool {
+	if f.marker == nil {
+		return false
+	}
+	a := split(path)
+	for i := range min(len(a), len(f.marker)) {
+		if a[i] != f.marker[i] {
+			return a[i] < f.marker[i]
+		}
+	}
+	// the marker itself, or the completed subtree
+	return len(a) == len(f.marker)
+}
+
+func (f *Finder) ancestor(path string) bool {
+	a := split(path)
+	if f.marker == nil || len(f.marker) <= len(a) {
+		return false
+	}
+	for i := range a {
+		if a[i] != f.marker[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Finder) walk(ctx context.Context, root string) error {
+	return f.FS.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
+		f.last = path
+		if f.marker != nil && !f.ancestor(path) && !f.done(path) {
+			// passed the marker
+			f.marker = nil
+		}
 		switch {
 		case err != nil:
-			f.error(err)
-		case de.Type()&^fs.ModeSymlink == 0:
-			info, err := de.Info()
-			if err != nil {
-				return err
+			f.obs.OnError(err)
+		case path != root && f.excluded(root, path):
+			if de.IsDir() {
+				return fs.SkipDir
 			}
-			fi := &fileStatEx{
-				FileInfo: info,
-				path:     path,
+		case f.done(path):
+			if de.IsDir() {
+				return fs.SkipDir
 			}
-			if err := f.db.Update(fi); err != nil {
-				switch err.(type) {
-				case *os.PathError:
-					f.error(err)
-				default:
-					return err
-				}
+		case de.Type()&^fs.ModeSymlink == 0:
+			fi, err := f.stat(path, de)
+			if err != nil || fi == nil {
+				return err
 			}
-			f.p.Update(1)
+			return f.update(fi)
 		}
 		return nil
 	})
-	if err != nil {
+}
+
+func (f *Finder) walkParallel(ctx context.Context, root string) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		q    = newDirQueue()
+		ch   = make(chan walkEntry, f.Workers)
+		once sync.Once
+		werr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			werr = err
+			cancel()
+			q.close()
+		})
+	}
+	post := func(e walkEntry) bool {
+		select {
+		case ch <- e:
+			return true
+		case <-wctx.Done():
+			return false
+		}
+	}
+	send := func(path string, de fs.DirEntry) bool {
+		fi, err := f.stat(path, de)
+		switch {
+		case err != nil:
+			fail(err)
+			return false
+		case fi == nil:
+			return false
+		}
+		return post(walkEntry{fi: fi})
+	}
+
+	switch fi, err := f.FS.Lstat(root); {
+	case err != nil:
+		f.obs.OnError(err)
+		return nil
+	case !fi.IsDir():
+		if fi.Mode().Type()&^fs.ModeSymlink != 0 || f.skip(fi) {
+			return nil
+		}
+		return f.update(fi)
+	}
+	f.tops = nil
+	f.pending = make(map[string]int)
+	q.push(root)
+	defer context.AfterFunc(wctx, q.close)()
+
+	for range f.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				dir, ok := q.pop()
+				if !ok {
+					return
+				}
+				list, err := f.FS.ReadDir(dir)
+				if err != nil {
+					post(walkEntry{err: err})
+				}
+				if dir == root {
+					f.enter(list)
+				}
+				// popped in walk order
+				for _, de := range slices.Backward(list) {
+					if wctx.Err() != nil {
+						break
+					}
+					path := filepath.Join(dir, de.Name())
+					if dir != root {
+						f.add(path, 1)
+					}
+					switch {
+					case f.excluded(root, path):
+					case de.IsDir():
+						if !f.done(path) {
+							q.push(path)
+							continue
+						}
+					case f.done(path):
+					case de.Type()&^fs.ModeSymlink == 0:
+						if send(path, de) {
+							continue
+						}
+					}
+					f.add(path, -1)
+				}
+				if dir != root {
+					f.add(dir, -1)
+				}
+				q.done()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	// writer
+	for e := range ch {
+		switch {
+		case wctx.Err() != nil:
+		case e.err != nil:
+			// observer is called only from the writer
+			f.obs.OnError(e.err)
+		default:
+			if err := f.update(e.fi); err != nil {
+				fail(err)
+			}
+			f.add(e.fi.Path(), -1)
+		}
+	}
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	return werr
+}
 
-	return f.db.Commit()
+// enter registers the entries of the root. Each of them is pending until its
+// subtree is walked and written.
+func (f *Finder) enter(list []fs.DirEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, de := range list {
+		p := filepath.Join(f.root.Path, de.Name())
+		f.tops = append(f.tops, p)
+		f.pending[p] = 1
+	}
+}
+
+func (f *Finder) add(path string, n int) {
+	rel, err := filepath.Rel(f.root.Path, path)
+	if err != nil {
+		return
+	}
+	if i := strings.IndexRune(rel, filepath.Separator); i != -1 {
+		rel = rel[:i]
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending[filepath.Join(f.root.Path, rel)] += n
+}
+
+// completed returns the last entry of the root which completes the subtrees
+// in walk order.
+func (f *Finder) completed() (last string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range f.tops {
+		if f.pending[p] != 0 {
+			break
+		}
+		last = p
+	}
+	return
+}
+
+type walkEntry struct {
+	fi  FileInfoEx
+	err error
+}
+
+func (f *Finder) stat(path string, de fs.DirEntry) (FileInfoEx, error) {
+	fi, err := info(path, de)
+	switch {
+	case err != nil:
+		return nil, err
+	case f.skip(fi):
+		return nil, nil
+	}
+	return fi, nil
+}
+
+func (f *Finder) skip(fi FileInfoEx) bool {
+	if fi.Mode().IsRegular() && (fi.Size() < f.MinSize || (0 < f.MaxSize && f.MaxSize < fi.Size())) {
+		return true
+	}
+	return f.ignored(fi)
+}
+
+var tmpRx = regexp.MustCompile(`^(.+)\.(\d+)_\d+$`)
+
+func (f *Finder) ignored(fi FileInfoEx) bool {
+	for _, c := range f.cache {
+		if SameFile(fi, c) {
+			return true
+		}
+	}
+	// temporary file of the interrupted Deduper
+	if m := tmpRx.FindStringSubmatch(fi.Name()); m != nil && m[2] == f.pid {
+		return f.tmp[filepath.Join(filepath.Dir(fi.Path()), m[1])]
+	}
+	return false
+}
+
+func (f *Finder) update(fi FileInfoEx) error {
+	if err := f.db.Update(f.FS, fi); err != nil {
+		switch err.(type) {
+		case *os.PathError:
+			f.obs.OnError(err)
+		default:
+			return err
+		}
+	} else {
+		f.obs.OnScan(fi)
+	}
+	f.p.Update(1)
+	return f.checkpoint()
+}
+
+func (f *Finder) excluded(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for _, pat := range f.Exclude {
+		pat = filepath.FromSlash(pat)
+		if ok, _ := filepath.Match(pat, filepath.Base(path)); ok {
+			return true
+		} else if ok, _ := filepath.Match(pat, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	list    []string
+	pending int
+	closed  bool
+}
+
+func newDirQueue() *dirQueue {
+	q := new(dirQueue)
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(dir string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.list = append(q.list, dir)
+	q.pending++
+	q.cond.Signal()
+}
+
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.list) == 0 && 0 < q.pending && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.list) == 0 || q.closed {
+		return "", false
+	}
+	// depth-first
+	n := len(q.list) - 1
+	dir := q.list[n]
+	q.list = q.list[:n]
+	return dir, true
+}
+
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending--; q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+func (q *dirQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
 }
 
-func (f *Finder) error(err error) {
-	f.p.Clear()
-	f.ui.Errorln("error:", err)
+func split(path string) []string {
+	vol := filepath.VolumeName(path)
+	return append([]string{vol}, strings.Split(strings.Trim(path[len(vol):], string(filepath.Separator)), string(filepath.Separator))...)
 }
@@ -1,7 +1,7 @@
 //
 // hiiragi :: finder_test.go
 //
-//   Copyright (c) 2016-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -10,10 +10,13 @@ package hiiragi_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hattya/go.cli"
 	"github.com/hattya/hiiragi"
@@ -44,7 +47,7 @@ func TestFinder(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	f := hiiragi.NewFinder(ui, db)
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
 	if err := f.Walk(ctx, root); err != nil {
 		t.Fatal(err)
 	}
@@ -82,7 +85,7 @@ func TestFinderInterrupt(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	f := hiiragi.NewFinder(ui, db)
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
 	if err := f.Walk(ctx, root); err != context.Canceled {
 		t.Fatal(err)
 	}
@@ -91,3 +94,356 @@ func TestFinderInterrupt(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFinderIgnore(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"file1", "file1.123_1", "file1.456_1", "backup", "backup.20240101_1200"} {
+		if err := touch(filepath.Join(dir, n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, workers := range []int{1, 4} {
+		db, err := hiiragi.Create(filepath.Join(dir, "hiiragi.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// interrupted Deduper
+		if err := db.SetIntent(&hiiragi.Intent{PID: 123, Paths: []string{filepath.Join(dir, "file1")}}); err != nil {
+			t.Fatal(err)
+		}
+
+		f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.Workers = workers
+		if err := f.Walk(ctx, dir); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if err := count(db, 4); err != nil {
+			t.Errorf("%v (workers = %v)", err, workers)
+		}
+		db.Close()
+	}
+}
+
+func TestFinderFilter(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for n, data := range map[string]string{
+		"1":         "",
+		"2":         "data\n",
+		"3":         "hiiragi\n",
+		"1.tmp":     "data\n",
+		".git/HEAD": "data\n",
+		"a/1":       "data\n",
+		"a/b/1":     "data\n",
+	} {
+		if err := m.WriteFile(filepath.Join(root, n), []byte(data), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tt := range []struct {
+		exclude []string
+		min     int64
+		max     int64
+		n       int
+	}{
+		{nil, 0, 0, 7},
+		{[]string{"*.tmp", ".git"}, 0, 0, 5},
+		{[]string{"a/b"}, 0, 0, 6},
+		{nil, 1, 0, 6},
+		{nil, 0, 5, 6},
+		{[]string{"a"}, 1, 5, 3},
+	} {
+		for _, workers := range []int{1, 4} {
+			db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+			f.FS = m
+			f.Exclude = tt.exclude
+			f.MinSize = tt.min
+			f.MaxSize = tt.max
+			f.Workers = workers
+			if err := f.Walk(ctx, root); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			if err := count(db, tt.n); err != nil {
+				t.Errorf("%v (workers = %v)", err, workers)
+			}
+			db.Close()
+		}
+	}
+}
+
+func TestFinderParallel(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for i := range 10 {
+		for j := range 10 {
+			if err := m.WriteFile(filepath.Join(root, fmt.Sprint(i), fmt.Sprint(j), "1"), []byte("data\n"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := m.Symlink("1", filepath.Join(root, "0", "l")); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	f.Workers = 8
+	if err := f.Walk(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := count(db, 101); err != nil {
+		t.Error(err)
+	}
+	// readdir error
+	m.Hook = func(op, name string) error {
+		if op == "readdir" && filepath.Base(name) == "9" {
+			return errors.New("injected")
+		}
+		return nil
+	}
+	r := new(recorder)
+	f = hiiragi.NewFinder(r, db)
+	f.FS = m
+	f.Workers = 8
+	if err := f.Walk(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if g, e := len(r.errs), 10; g != e {
+		t.Errorf("expected OnError to be called %v times, got %v", e, g)
+	}
+	if g, e := r.scan, 9*9+1; g != e {
+		t.Errorf("expected OnScan to be called %v times, got %v", e, g)
+	}
+	// error
+	m.Hook = func(op, name string) error {
+		if op == "lstat" && filepath.Base(name) == "1" {
+			return errors.New("injected")
+		}
+		return nil
+	}
+	f = hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	f.Workers = 8
+	if err := f.Walk(ctx, root); err == nil {
+		t.Error("expected error")
+	}
+	f.Close()
+	// interrupt
+	m.Hook = nil
+	cancel()
+	f = hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	f.Workers = 8
+	if err := f.Walk(ctx, root); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	f.Close()
+}
+
+func TestFinderScanInfo(t *testing.T) {
+	m, _ := createMemFiles(t)
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if si, err := db.ScanInfo(); err != nil {
+		t.Fatal(err)
+	} else if si != nil {
+		t.Errorf("expected nil, got %v", si)
+	}
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := filepath.Join(string(filepath.Separator), "root")
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	f.MinSize = 1
+	f.Options = map[string]string{"name": "true"}
+	for _, p := range []string{filepath.Join(root, "a"), filepath.Join(root, "b")} {
+		f.Exclude = []string{"*.tmp"}
+		if err := f.Walk(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	si, err := db.ScanInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := si.Version, hiiragi.Version; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if si.End.Before(si.Start) {
+		t.Errorf("expected %v <= %v", si.Start, si.End)
+	}
+	if g, e := len(si.Roots), 2; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	if len(si.Diff(si)) != 0 {
+		t.Error("expected no differences")
+	}
+	// different options
+	o := &hiiragi.ScanInfo{
+		Roots:   si.Roots[:1],
+		MinSize: 1,
+		Options: map[string]string{"name": "false"},
+	}
+	if g, e := len(si.Diff(o)), 2; g != e {
+		t.Errorf("expected %v, got %v: %q", e, g, si.Diff(o))
+	}
+}
+
+func TestFinderResume(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		m := hiiragi.NewMemFS()
+		root := filepath.Join(string(filepath.Separator), "root")
+		for i := range 10 {
+			for j := range 10 {
+				if err := m.WriteFile(filepath.Join(root, fmt.Sprint(i), fmt.Sprint(j)), []byte("data\n"), 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		ui := cli.NewCLI()
+		ui.Stdout = io.Discard
+		ui.Stderr = io.Discard
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// interrupted
+		m.Hook = func(op, name string) error {
+			if op == "lstat" && name == filepath.Join(root, "5", "5") {
+				// wait for the other walkers
+				time.Sleep(100 * time.Millisecond)
+				return errors.New("injected")
+			}
+			return nil
+		}
+		f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.FS = m
+		f.Workers = workers
+		f.Bulk = true
+		f.CommitEvery = 10
+		if err := f.Walk(ctx, root); err == nil {
+			t.Fatal("expected error")
+		}
+		f.Close()
+		si, err := db.ScanInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if si.Done() {
+			t.Fatalf("expected scan to be interrupted (workers = %v)", workers)
+		}
+		last := si.Roots[0].Last
+		_, n, err := db.NumFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 || 100 <= n {
+			t.Errorf("expected 0 < %v < 100 (workers = %v)", n, workers)
+		}
+		// resume
+		var lstat atomic.Int64
+		m.Hook = func(op, name string) error {
+			if op == "lstat" {
+				lstat.Add(1)
+			}
+			return nil
+		}
+		f = hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.FS = m
+		f.Workers = workers
+		f.Bulk = true
+		f.Resume(si)
+		if err := f.Walk(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if err := count(db, 100); err != nil {
+			t.Errorf("%v (workers = %v)", err, workers)
+		}
+		e := 100 - n + 1
+		if workers > 1 {
+			// completed subtrees
+			if last == "" {
+				t.Fatalf("expected completed subtrees (workers = %v)", workers)
+			}
+			e = 100 - 10*(int64(last[len(root)+1]-'0')+1) + 1
+		}
+		if g := lstat.Load(); e < g {
+			t.Errorf("expected lstat <= %v, got %v (workers = %v)", e, g, workers)
+		}
+		if si, err = db.ScanInfo(); err != nil {
+			t.Fatal(err)
+		} else if !si.Done() {
+			t.Error("expected scan to be done")
+		}
+		// done
+		f = hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.FS = m
+		f.Resume(si)
+		lstat.Store(0)
+		if err := f.Walk(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if g, e := lstat.Load(), int64(0); g != e {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+}
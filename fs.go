@@ -0,0 +1,87 @@
+//
+// hiiragi :: fs.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type FS interface {
+	WalkDir(root string, fn fs.WalkDirFunc) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Lstat(name string) (FileInfoEx, error)
+	Open(name string) (io.ReadCloser, error)
+	Link(oldname, newname string) error
+	Symlink(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Readlink(name string) (string, error)
+	Xattrs(name string) (map[string][]byte, error)
+	Label(name string) ([]byte, error)
+	Chtimes(name string, atime, mtime time.Time) error
+	Lchtimes(name string, atime, mtime time.Time) error
+}
+
+type OSFS struct{}
+
+func (OSFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) Lstat(name string) (FileInfoEx, error) {
+	return Lstat(name)
+}
+
+func (OSFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (OSFS) Link(oldname, newname string) error {
+	return Link(oldname, newname)
+}
+
+func (OSFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (OSFS) Xattrs(name string) (map[string][]byte, error) {
+	return xattrs(name)
+}
+
+func (OSFS) Label(name string) ([]byte, error) {
+	return label(name)
+}
+
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFS) Lchtimes(name string, atime, mtime time.Time) error {
+	return Lchtimes(name, atime, mtime)
+}
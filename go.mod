@@ -3,6 +3,7 @@ module github.com/hattya/hiiragi
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/hattya/go.cli v0.1.0
 	github.com/mackerelio/go-osstat v0.2.6
 	github.com/mattn/go-colorable v0.1.14
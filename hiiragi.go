@@ -1,7 +1,7 @@
 //
 // hiiragi :: hiiragi.go
 //
-//   Copyright (c) 2016-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -12,40 +12,70 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
-
-	"github.com/hattya/go.cli"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const Version = "0.0+"
 
 type Deduper struct {
-	Attrs    bool
-	Mtime    When
-	Name     bool
-	Pretend  bool
-	Progress bool
-
-	ui  *cli.CLI
+	FS           FS
+	Attrs        bool
+	Xattrs       bool
+	IgnoreXattrs []string
+	Mtime        When
+	KeepMtime    When
+	KeepAtime    When
+	Name         bool
+	KeepDirTimes bool
+	Strategy     Strategy
+	Pretend      bool
+
+	obs Observer
 	db  *DB
 	p   *counter
 	pid int
 	i   int
+	sum Summary
+}
+
+type Summary struct {
+	Groups     int64
+	Linked     int64
+	Saved      int64
+	Shared     int64 // entries which were already linked
+	SharedSize int64
+	Partial    int64 // groups which were partially linked
 }
 
-func NewDeduper(ui *cli.CLI, db *DB) *Deduper {
+func (s *Summary) String() string {
+	return fmt.Sprintf("%v groups, %v linked (%v saved), %v already linked (%v), %v partially linked groups", s.Groups, s.Linked, formatBytes(s.Saved), s.Shared, formatBytes(s.SharedSize), s.Partial)
+}
+
+func NewDeduper(obs Observer, db *DB) *Deduper {
 	return &Deduper{
-		Attrs:    true,
-		Name:     true,
-		Progress: true,
-		ui:       ui,
-		db:       db,
-		p:        newCounter(ui, "dedup"),
-		pid:      os.Getpid(),
+		FS:    OSFS{},
+		Attrs: true,
+		Name:  true,
+		obs:   obs,
+		db:    db,
+		p:     newCounter(obs, "dedup"),
+		pid:   os.Getpid(),
 	}
 }
 
+func (d *Deduper) Summary() *Summary {
+	s := d.sum
+	return &s
+}
+
 func (d *Deduper) All(ctx context.Context) error {
+	if err := d.recover(); err != nil {
+		return err
+	}
 	// file
 	f, n, err := d.db.NumFiles()
 	if err != nil {
@@ -59,8 +89,11 @@ func (d *Deduper) All(ctx context.Context) error {
 	}
 	d.p.N += n
 	d.p.Set(f + s)
+	// bytes
+	if d.p.Size, err = d.db.FileSize(d.Mtime == 0); err != nil {
+		return err
+	}
 
-	d.p.Show = d.Progress
 	d.p.Update(0)
 	defer d.p.Close()
 
@@ -71,6 +104,9 @@ func (d *Deduper) All(ctx context.Context) error {
 }
 
 func (d *Deduper) Files(ctx context.Context) error {
+	if err := d.recover(); err != nil {
+		return err
+	}
 	// file
 	done, n, err := d.db.NumFiles()
 	if err != nil {
@@ -78,8 +114,11 @@ func (d *Deduper) Files(ctx context.Context) error {
 	}
 	d.p.N = n
 	d.p.Set(done)
+	// bytes
+	if d.p.Size, err = d.db.FileSize(d.Mtime == 0); err != nil {
+		return err
+	}
 
-	d.p.Show = d.Progress
 	d.p.Update(0)
 	defer d.p.Close()
 
@@ -97,6 +136,7 @@ func (d *Deduper) files(ctx context.Context) error {
 		default:
 		}
 
+		d.p.Phase("prefilter")
 		files, err := d.db.NextFiles(ctx, mtime, order)
 		switch {
 		case err != nil || len(files) == 0:
@@ -120,7 +160,7 @@ func (d *Deduper) files(ctx context.Context) error {
 			default:
 			}
 
-			fi, err := Lstat(f.Path)
+			fi, err := d.FS.Lstat(f.Path)
 			switch {
 			case err != nil:
 				return err
@@ -128,21 +168,37 @@ func (d *Deduper) files(ctx context.Context) error {
 				if err = d.skip(f.Path); err != nil {
 					return err
 				}
+				d.p.Add(f.Size)
 				continue
 			}
 
-			h, err := Sum(f.Path)
+			d.p.Phase("hash")
+			h, err := sum(d.FS, f.Path, d.p)
 			if err != nil {
 				return err
 			}
 			hash[h] = append(hash[h], fi)
 		}
+		var paths []string
+		for _, v := range hash {
+			if len(v) > 1 {
+				for _, fi := range v {
+					paths = append(paths, fi.Path())
+				}
+			}
+		}
+		if err = d.intend(paths); err != nil {
+			return err
+		}
 		for _, v := range hash {
 			if err = d.dedup(ctx, v); err != nil {
 				return err
 			}
 		}
 
+		if err = d.db.SetIntent(nil); err != nil {
+			return err
+		}
 		if err = d.db.Commit(); err != nil {
 			return err
 		}
@@ -150,6 +206,9 @@ func (d *Deduper) files(ctx context.Context) error {
 }
 
 func (d *Deduper) Symlinks(ctx context.Context) error {
+	if err := d.recover(); err != nil {
+		return err
+	}
 	// symlink
 	done, n, err := d.db.NumSymlinks()
 	if err != nil {
@@ -158,7 +217,6 @@ func (d *Deduper) Symlinks(ctx context.Context) error {
 	d.p.N = n
 	d.p.Set(done)
 
-	d.p.Show = d.Progress
 	d.p.Update(0)
 	defer d.p.Close()
 
@@ -176,6 +234,7 @@ func (d *Deduper) symlinks(ctx context.Context) error {
 		default:
 		}
 
+		d.p.Phase("prefilter")
 		syms, err := d.db.NextSymlinks(ctx, mtime, order)
 		switch {
 		case err != nil || len(syms) == 0:
@@ -199,7 +258,7 @@ func (d *Deduper) symlinks(ctx context.Context) error {
 			default:
 			}
 
-			fi, err := Lstat(s.Path)
+			fi, err := d.FS.Lstat(s.Path)
 			switch {
 			case err != nil:
 				return err
@@ -210,10 +269,10 @@ func (d *Deduper) symlinks(ctx context.Context) error {
 				continue
 			}
 
-			switch t, err := os.Readlink(s.Path); {
+			switch t, err := d.FS.Readlink(s.Path); {
 			case err != nil:
 				return err
-			case t != s.Target:
+			case d.db.target(s.Path, t) != s.Target:
 				if err = d.skip(s.Path); err != nil {
 					return err
 				}
@@ -221,10 +280,22 @@ func (d *Deduper) symlinks(ctx context.Context) error {
 			}
 			v = append(v, fi)
 		}
+		if len(v) > 1 {
+			var paths []string
+			for _, fi := range v {
+				paths = append(paths, fi.Path())
+			}
+			if err = d.intend(paths); err != nil {
+				return err
+			}
+		}
 		if err = d.dedup(ctx, v); err != nil {
 			return err
 		}
 
+		if err = d.db.SetIntent(nil); err != nil {
+			return err
+		}
 		if err = d.db.Commit(); err != nil {
 			return err
 		}
@@ -241,7 +312,22 @@ func (d *Deduper) mtime() (bool, Order) {
 }
 
 func (d *Deduper) dedup(ctx context.Context, list []FileInfoEx) (err error) {
+	d.p.Phase("link")
+	if len(list) > 1 {
+		d.obs.OnGroup(list)
+		d.sum.Groups++
+	}
 	var src FileInfoEx
+	var mtime, atime time.Time
+	var n int
+	var shared, linked int64
+	// remaining links of the inodes
+	links := make(map[[2]uint64]uint64)
+	defer func() {
+		if shared > 0 && linked > 0 {
+			d.sum.Partial++
+		}
+	}()
 	if d.Name {
 		sort.SliceStable(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
 	}
@@ -254,60 +340,286 @@ func (d *Deduper) dedup(ctx context.Context, list []FileInfoEx) (err error) {
 
 		switch {
 		case src == nil || (d.Name && src.Name() != dst.Name()):
+			if err = d.touch(src, mtime, atime, n); err != nil {
+				return
+			}
 			src = dst
+			mtime = dst.ModTime()
+			atime = dst.Atime()
+			n = 0
 			d.i = 0
 		case SameFile(src, dst):
+			shared++
+			d.sum.Shared++
+			if dst.Mode().IsRegular() {
+				d.sum.SharedSize += dst.Size()
+			}
+		case !d.sameTarget(src, dst) || !d.sameDev(src, dst):
 			// skip
-		case !d.Attrs || SameAttrs(src, dst):
-			if err = d.link(src.Path(), dst.Path()); err != nil {
+		case d.sameAttrs(src, dst):
+			if err = d.link(src, dst); err != nil {
 				return
 			}
+			mtime = d.KeepMtime.choose(mtime, dst.ModTime())
+			atime = d.KeepAtime.choose(atime, dst.Atime())
+			n++
+			linked++
+			d.sum.Linked++
+			if dst.Mode().IsRegular() && unlinked(links, dst) {
+				d.sum.Saved += dst.Size()
+			}
 		}
 		if err = d.db.Done(dst.Path()); err != nil {
 			return
 		}
 		d.p.Update(1)
 	}
-	return
+	return d.touch(src, mtime, atime, n)
+}
+
+// unlinked reports whether the last link of the inode went away.
+func unlinked(links map[[2]uint64]uint64, fi FileInfoEx) bool {
+	dev, err := fi.Dev()
+	if err != nil {
+		return false
+	}
+	ino, err := fi.Ino()
+	if err != nil {
+		return false
+	}
+	k := [2]uint64{dev, ino}
+	n, ok := links[k]
+	if !ok {
+		if n, err = fi.Nlink(); err != nil {
+			return false
+		}
+	}
+	n--
+	links[k] = n
+	return n == 0
 }
 
-func (d *Deduper) link(src, dst string) (err error) {
-	d.p.Clear()
-	if d.i == 0 {
-		d.ui.Println(">>", src)
+func (d *Deduper) sameAttrs(src, dst FileInfoEx) bool {
+	if d.Attrs && !equalAttrs(src, dst, !d.symlink(src)) {
+		return false
+	}
+	// SELinux labels are compared even if attributes are ignored
+	if ok, err := sameLabel(d.FS, src, dst); err != nil {
+		d.obs.OnError(err)
+		return false
+	} else if !ok {
+		return false
+	}
+	if d.Attrs && d.Xattrs {
+		if ok, err := SameXattrs(d.FS, src, dst, d.IgnoreXattrs); err != nil {
+			d.obs.OnError(err)
+			return false
+		} else if !ok {
+			return false
+		}
 	}
-	d.ui.Println(" +", dst)
+	return true
+}
+
+func (d *Deduper) symlink(src FileInfoEx) bool {
+	return d.Strategy != HardLink && src.Mode().IsRegular()
+}
+
+func (d *Deduper) sameDev(src, dst FileInfoEx) bool {
+	if d.symlink(src) {
+		return true
+	}
+	dev1, err := src.Dev()
+	if err != nil {
+		return false
+	}
+	dev2, err := dst.Dev()
+	return err == nil && dev1 == dev2
+}
+
+func (d *Deduper) sameTarget(src, dst FileInfoEx) bool {
+	if d.db.norm == 0 || src.Mode().Type() != os.ModeSymlink {
+		return true
+	}
+	// dst will have the target of src
+	t, err := d.FS.Readlink(src.Path())
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(t) {
+		t = filepath.Dir(dst.Path()) + string(filepath.Separator) + t
+	}
+	p1, err := realpath(d.FS, dst.Path())
+	if err != nil {
+		return false
+	}
+	p2, err := realpath(d.FS, t)
+	return err == nil && p1 == p2
+}
+
+func (d *Deduper) touch(src FileInfoEx, mtime, atime time.Time, n int) error {
+	if src == nil || n == 0 || d.Pretend {
+		return nil
+	}
+	// zero times are left unchanged
+	if d.KeepMtime == 0 || mtime.Equal(src.ModTime()) {
+		mtime = time.Time{}
+	}
+	if d.KeepAtime == 0 || atime.Equal(src.Atime()) {
+		atime = time.Time{}
+	}
+	if mtime.IsZero() && atime.IsZero() {
+		return nil
+	}
+	// symlinks are not followed
+	return d.FS.Lchtimes(src.Path(), atime, mtime)
+}
+
+func (d *Deduper) link(fi1, fi2 FileInfoEx) (err error) {
+	src := fi1.Path()
+	dst := fi2.Path()
+	d.obs.OnLink(src, dst)
 
 	if !d.Pretend {
 		var tmp string
 		for {
 			d.i++
 			tmp = fmt.Sprintf("%v.%v_%v", dst, d.pid, d.i)
-			if !exists(tmp) {
+			if !exists(d.FS, tmp) {
 				break
 			}
 		}
-		defer os.Rename(tmp, dst)
+		if d.KeepDirTimes {
+			dir := filepath.Dir(dst)
+			var fi FileInfoEx
+			if fi, err = d.FS.Lstat(dir); err != nil {
+				return
+			}
+			defer func() {
+				// ctime cannot be restored
+				if e := d.FS.Chtimes(dir, time.Time{}, fi.ModTime()); err == nil {
+					err = e
+				}
+			}()
+		}
+		defer d.FS.Rename(tmp, dst)
 
-		if err = os.Rename(dst, tmp); err != nil {
+		if err = d.FS.Rename(dst, tmp); err != nil {
 			return
 		}
-		if err = Link(src, dst); err != nil {
+		if d.symlink(fi1) {
+			var t string
+			if t, err = d.Strategy.target(src, dst); err != nil {
+				return
+			}
+			err = d.FS.Symlink(t, dst)
+		} else {
+			err = d.FS.Link(src, dst)
+		}
+		if err != nil {
 			return
 		}
-		err = os.Remove(tmp)
+		err = d.FS.Remove(tmp)
 	}
 	return
 }
 
+func (d *Deduper) intend(paths []string) error {
+	if d.Pretend || len(paths) == 0 {
+		return nil
+	}
+	// record the group before linking
+	if err := d.db.SetIntent(&Intent{PID: d.pid, Paths: paths}); err != nil {
+		return err
+	}
+	if err := d.db.Commit(); err != nil {
+		return err
+	}
+	return d.db.Begin()
+}
+
+func (d *Deduper) recover() error {
+	in, err := d.db.Intent()
+	if err != nil || in == nil || d.Pretend {
+		return err
+	}
+	for _, p := range in.Paths {
+		dir := filepath.Dir(p)
+		list, err := d.FS.ReadDir(dir)
+		if err != nil {
+			d.obs.OnError(err)
+			continue
+		}
+		prefix := fmt.Sprintf("%v.%v_", filepath.Base(p), in.PID)
+		for _, de := range list {
+			n, ok := strings.CutPrefix(de.Name(), prefix)
+			if !ok {
+				continue
+			} else if _, err := strconv.Atoi(n); err != nil {
+				continue
+			}
+			tmp := filepath.Join(dir, de.Name())
+			if exists(d.FS, p) {
+				// linked
+				err = d.FS.Remove(tmp)
+			} else {
+				// roll back
+				err = d.FS.Rename(tmp, p)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return d.db.SetIntent(nil)
+}
+
 func (d *Deduper) skip(name string) error {
 	if err := d.db.Done(name); err != nil {
 		return err
 	}
+	d.obs.OnSkip(name)
 	d.p.Update(1)
 	return nil
 }
 
+type Strategy uint
+
+const (
+	HardLink Strategy = iota
+	AbsSymlink
+	RelSymlink
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case HardLink:
+		return "HardLink"
+	case AbsSymlink:
+		return "AbsSymlink"
+	case RelSymlink:
+		return "RelSymlink"
+	}
+	return fmt.Sprintf("Strategy(%d)", s)
+}
+
+func (s Strategy) target(src, dst string) (string, error) {
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return "", err
+	}
+	if s == RelSymlink {
+		if dst, err = filepath.Abs(dst); err != nil {
+			return "", err
+		}
+		// fails across volumes
+		if rel, err := filepath.Rel(filepath.Dir(dst), src); err == nil {
+			return rel, nil
+		}
+	}
+	return src, nil
+}
+
 type When uint
 
 const (
@@ -326,3 +638,10 @@ func (w When) String() string {
 	}
 	return fmt.Sprintf("When(%d)", w)
 }
+
+func (w When) choose(t1, t2 time.Time) time.Time {
+	if (w == Oldest && t2.Before(t1)) || (w == Latest && t2.After(t1)) {
+		return t2
+	}
+	return t1
+}
@@ -10,6 +10,7 @@ package hiiragi_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -216,7 +217,7 @@ func TestDedupNoFiles(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	f := hiiragi.NewFinder(ui, db)
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
 	if err := f.Walk(ctx, root); err != nil {
 		t.Fatal(err)
 	}
@@ -238,7 +239,7 @@ func TestDedupNoFiles(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	d := hiiragi.NewDeduper(ui, db)
+	d := hiiragi.NewDeduper(hiiragi.NewTerminal(ui), db)
 	if err := d.Files(ctx); err != nil {
 		t.Fatal(err)
 	}
@@ -448,6 +449,429 @@ func TestDedupFilesInterrupt(t *testing.T) {
 	}
 }
 
+func TestDedupFilesMemFS(t *testing.T) {
+	m, files := createMemFiles(t)
+	if _, err := dedupMemFS(t, m, "files", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if !sameMemFile(m, files[0], files[1]) {
+		t.Error("files should be same")
+	}
+	if sameMemFile(m, files[0], files[2]) {
+		t.Error("files should be different")
+	}
+}
+
+func TestDedupFilesLinkError(t *testing.T) {
+	m, files := createMemFiles(t)
+	m.Hook = func(op, name string) error {
+		if op == "link" {
+			return errors.New("injected")
+		}
+		return nil
+	}
+	if _, err := dedupMemFS(t, m, "files", map[string]any{}); err == nil {
+		t.Fatal("expected error")
+	}
+	m.Hook = nil
+	if sameMemFile(m, files[0], files[1]) {
+		t.Error("files should be different")
+	}
+	// restored
+	for _, n := range files {
+		if _, err := m.Lstat(n); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDedupFilesModified(t *testing.T) {
+	m, files := createMemFiles(t)
+	m.Hook = func(op, name string) error {
+		if op == "read" && name == files[1] {
+			m.Hook = nil
+			return m.WriteFile(name, []byte("hiiragi\n"), 0o666)
+		}
+		return nil
+	}
+	if _, err := dedupMemFS(t, m, "files", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if sameMemFile(m, files[0], files[1]) {
+		t.Error("files should be different")
+	}
+}
+
+func TestDedupFilesXattrs(t *testing.T) {
+	for _, tt := range []struct {
+		xattrs bool
+		ignore []string
+		same   bool
+	}{
+		{false, nil, true},
+		{true, nil, false},
+		{true, []string{"user"}, true},
+		{true, []string{"user.provenance"}, true},
+		{true, []string{"security"}, false},
+	} {
+		m, files := createMemFiles(t)
+		if err := m.Setxattr(files[1], "user.provenance", []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		_, err := dedupMemFS(t, m, "files", map[string]any{
+			"xattrs":        tt.xattrs,
+			"ignore-xattrs": tt.ignore,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := sameMemFile(m, files[0], files[1]), tt.same; g != e {
+			t.Errorf("expected %v, got %v (xattrs = %v, ignore = %v)", e, g, tt.xattrs, tt.ignore)
+		}
+	}
+}
+
+func TestDedupFilesXattrsError(t *testing.T) {
+	m, files := createMemFiles(t)
+	m.Hook = func(op, name string) error {
+		if op == "xattrs" && name == files[1] {
+			return errors.New("injected")
+		}
+		return nil
+	}
+	r := new(recorder)
+	_, err := dedupMemFS(t, m, "files", map[string]any{
+		"observer": r,
+		"xattrs":   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sameMemFile(m, files[0], files[1]) {
+		t.Error("files should be different")
+	}
+	if g, e := len(r.errs), 1; g != e {
+		t.Errorf("expected OnError to be called %v times, got %v", e, g)
+	}
+}
+
+func TestDedupFilesLabel(t *testing.T) {
+	for _, attrs := range []bool{true, false} {
+		m, files := createMemFiles(t)
+		for i, v := range []string{"system_u:object_r:bin_t:s0", "system_u:object_r:container_file_t:s0"} {
+			if err := m.Setxattr(files[i], "security.selinux", []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := dedupMemFS(t, m, "files", map[string]any{
+			"attrs": attrs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sameMemFile(m, files[0], files[1]) {
+			t.Errorf("files should be different (attrs = %v)", attrs)
+		}
+	}
+}
+
+func TestDedupFilesGranularity(t *testing.T) {
+	for _, tt := range []struct {
+		gran   time.Duration
+		d1, d2 time.Duration
+		same   bool
+	}{
+		{time.Second, 0, 500 * time.Millisecond, true},
+		{time.Millisecond, 0, 500 * time.Millisecond, false},
+		{2 * time.Second, 12100 * time.Millisecond, 13900 * time.Millisecond, true},
+		{2 * time.Second, 11900 * time.Millisecond, 12100 * time.Millisecond, false},
+	} {
+		m, files := createMemFiles(t)
+		fi, err := m.Lstat(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtime := fi.ModTime().Truncate(time.Minute)
+		for i, d := range []time.Duration{tt.d1, tt.d2} {
+			if err := m.Chtimes(files[i], time.Time{}, mtime.Add(d)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = dedupMemFS(t, m, "files", map[string]any{
+			"granularity": tt.gran,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := sameMemFile(m, files[0], files[1]), tt.same; g != e {
+			t.Errorf("expected %v, got %v (granularity = %v, mtimes = %v, %v)", e, g, tt.gran, tt.d1, tt.d2)
+		}
+	}
+}
+
+func TestDedupFilesKeepDirTimes(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		m, files := createMemFiles(t)
+		dir := filepath.Dir(files[1])
+		mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := m.Chtimes(dir, time.Time{}, mtime); err != nil {
+			t.Fatal(err)
+		}
+		_, err := dedupMemFS(t, m, "files", map[string]any{
+			"keep-dir-times": keep,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameMemFile(m, files[0], files[1]) {
+			t.Error("files should be same")
+		}
+		fi, err := m.Lstat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := fi.ModTime().Equal(mtime), keep; g != e {
+			t.Errorf("expected %v, got %v (keep = %v)", e, g, keep)
+		}
+	}
+}
+
+func TestDedupFilesKeepMtime(t *testing.T) {
+	for _, tt := range []struct {
+		keep hiiragi.When
+		diff time.Duration
+	}{
+		{0, 0},
+		{hiiragi.Oldest, 0},
+		{hiiragi.Latest, 3 * time.Second},
+	} {
+		m, files := createMemFiles(t)
+		fi, err := m.Lstat(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtime := fi.ModTime()
+		_, err = dedupMemFS(t, m, "files", map[string]any{
+			"mtime":      hiiragi.Oldest,
+			"keep-mtime": tt.keep,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range files {
+			if !sameMemFile(m, files[0], n) {
+				t.Fatalf("files should be same (keep = %v)", tt.keep)
+			}
+		}
+		fi, err = m.Lstat(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := fi.ModTime(), mtime.Add(tt.diff); !g.Equal(e) {
+			t.Errorf("expected %v, got %v (keep = %v)", e, g, tt.keep)
+		}
+	}
+}
+
+func TestDedupFilesKeepAtime(t *testing.T) {
+	for _, tt := range []struct {
+		keep hiiragi.When
+		diff time.Duration
+	}{
+		{0, 0},
+		{hiiragi.Oldest, -time.Hour},
+		{hiiragi.Latest, time.Hour},
+	} {
+		m, files := createMemFiles(t)
+		fi, err := m.Lstat(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		atime := fi.Atime().Add(-24 * time.Hour)
+		mtime := fi.ModTime()
+		for i, d := range []time.Duration{0, -time.Hour, time.Hour} {
+			if err := m.Chtimes(files[i], atime.Add(d), time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = dedupMemFS(t, m, "files", map[string]any{
+			"mtime":      hiiragi.Oldest,
+			"keep-atime": tt.keep,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range files {
+			if !sameMemFile(m, files[0], n) {
+				t.Fatalf("files should be same (keep = %v)", tt.keep)
+			}
+		}
+		fi, err = m.Lstat(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := fi.Atime(), atime.Add(tt.diff); !g.Equal(e) {
+			t.Errorf("expected %v, got %v (keep = %v)", e, g, tt.keep)
+		}
+		// independent of keep-mtime
+		if g, e := fi.ModTime(), mtime; !g.Equal(e) {
+			t.Errorf("expected %v, got %v (keep = %v)", e, g, tt.keep)
+		}
+	}
+}
+
+func TestDedupFilesRecover(t *testing.T) {
+	m, files := createMemFiles(t)
+	path := filepath.Join(t.TempDir(), "hiiragi.db")
+	_, err := dedupMemFS(t, m, "files", map[string]any{
+		"db": path,
+		"intent": func() *hiiragi.Intent {
+			// killed after rename
+			if err := m.Rename(files[1], files[1]+".1234_1"); err != nil {
+				t.Fatal(err)
+			}
+			// killed after link
+			if err := m.Rename(files[2], files[2]+".1234_2"); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Link(files[0], files[2]); err != nil {
+				t.Fatal(err)
+			}
+			return &hiiragi.Intent{PID: 1234, Paths: files}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{files[1] + ".1234_1", files[2] + ".1234_2"} {
+		if _, err := m.Lstat(n); err == nil {
+			t.Errorf("%v should be removed", n)
+		}
+	}
+	if !sameMemFile(m, files[0], files[1]) {
+		t.Error("files should be same")
+	}
+	if !sameMemFile(m, files[0], files[2]) {
+		t.Error("files should be same")
+	}
+
+	db, err := hiiragi.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if in, err := db.Intent(); err != nil {
+		t.Fatal(err)
+	} else if in != nil {
+		t.Errorf("expected nil, got %v", in)
+	}
+}
+
+func TestDedupFilesSummary(t *testing.T) {
+	m, files := createMemFiles(t)
+	fi, err := m.Lstat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 of 3 are already linked
+	if err := m.Remove(files[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Link(files[0], files[1]); err != nil {
+		t.Fatal(err)
+	}
+	n := filepath.Join(string(filepath.Separator), "root", "c", "1")
+	if err := m.WriteFile(n, []byte("data\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Chtimes(n, time.Time{}, fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	d, err := dedupMemFS(t, m, "files", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameMemFile(m, files[0], n) {
+		t.Error("files should be same")
+	}
+	if g, e := *d.Summary(), (hiiragi.Summary{Groups: 1, Linked: 1, Saved: 5, Shared: 1, SharedSize: 5, Partial: 1}); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+
+	// 2 of 5 are linked to each other
+	m, files = createMemFiles(t)
+	var links []string
+	for _, p := range []string{"c/1", "d/1"} {
+		links = append(links, filepath.Join(string(filepath.Separator), "root", filepath.FromSlash(p)))
+	}
+	if err := m.WriteFile(links[0], []byte("data\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Chtimes(links[0], time.Time{}, fi.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Mkdir(filepath.Dir(links[1])); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Link(links[0], links[1]); err != nil {
+		t.Fatal(err)
+	}
+	d, err = dedupMemFS(t, m, "files", map[string]any{
+		"mtime": hiiragi.Oldest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range append(files[1:], links...) {
+		if !sameMemFile(m, files[0], n) {
+			t.Error("files should be same")
+		}
+	}
+	if g, e := *d.Summary(), (hiiragi.Summary{Groups: 1, Linked: 4, Saved: 15}); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestDedupFilesStrategy(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "root")
+	for _, tt := range []struct {
+		strategy hiiragi.Strategy
+		target   string
+	}{
+		{hiiragi.AbsSymlink, filepath.Join(root, "a", "1")},
+		{hiiragi.RelSymlink, filepath.Join("..", "a", "1")},
+	} {
+		m := hiiragi.NewMemFS()
+		now := time.Now().Truncate(time.Second)
+		for i, n := range []string{"a/1", "b/1"} {
+			// different devices
+			m.Dev = uint64(i + 1)
+			n = filepath.Join(root, n)
+			if err := m.WriteFile(n, []byte("data\n"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Chtimes(n, time.Time{}, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d, err := dedupMemFS(t, m, "files", map[string]any{
+			"cross-device": true,
+			"strategy":     tt.strategy,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := d.Summary().Linked, int64(1); g != e {
+			t.Errorf("%v: expected %v, got %v", tt.strategy, e, g)
+		}
+		if g, err := m.Readlink(filepath.Join(root, "b", "1")); err != nil {
+			t.Errorf("%v: %v", tt.strategy, err)
+		} else if e := tt.target; g != e {
+			t.Errorf("%v: expected %q, got %q", tt.strategy, e, g)
+		}
+	}
+}
+
 func TestDedupNoSymlinks(t *testing.T) {
 	if !supportsSymlinks {
 		t.Skipf("skipping on %v", runtime.GOOS)
@@ -490,7 +914,7 @@ func TestDedupNoSymlinks(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	f := hiiragi.NewFinder(ui, db)
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
 	if err := f.Walk(ctx, root); err != nil {
 		t.Fatal(err)
 	}
@@ -519,7 +943,7 @@ func TestDedupNoSymlinks(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	d := hiiragi.NewDeduper(ui, db)
+	d := hiiragi.NewDeduper(hiiragi.NewTerminal(ui), db)
 	if err := d.Symlinks(ctx); err != nil {
 		t.Fatal(err)
 	}
@@ -659,6 +1083,148 @@ func TestDedupSymlinksInterrupt(t *testing.T) {
 	}
 }
 
+func TestDedupSymlinksKeepTimes(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	target := filepath.Join(root, "1")
+	if err := m.WriteFile(target, []byte("data\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	if err := m.Chtimes(target, now.Add(-24*time.Hour), now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var links []string
+	for i, n := range []string{"a/l", "b/l"} {
+		n = filepath.Join(root, n)
+		if err := m.Symlink(target, n); err != nil {
+			t.Fatal(err)
+		}
+		ts := now.Add(time.Duration(i) * time.Hour)
+		if err := m.Lchtimes(n, ts, ts); err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, n)
+	}
+	_, err := dedupMemFS(t, m, "symlinks", map[string]any{
+		"mtime":      hiiragi.Oldest,
+		"keep-mtime": hiiragi.Latest,
+		"keep-atime": hiiragi.Latest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameMemFile(m, links[0], links[1]) {
+		t.Fatal("symlinks should be same")
+	}
+	fi, err := m.Lstat(links[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.ModTime(), now.Add(time.Hour); !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := fi.Atime(), now.Add(time.Hour); !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// target is unchanged
+	fi, err = m.Lstat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.ModTime(), now.Add(-24*time.Hour); !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := fi.Atime(), now.Add(-24*time.Hour); !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestDedupSymlinksTargets(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "root")
+	for _, tt := range []struct {
+		norm hiiragi.Normalize
+		e    []bool
+	}{
+		{0, []bool{false, false, false}},
+		{hiiragi.Clean, []bool{true, false, false}},
+		{hiiragi.Resolve, []bool{true, true, false}},
+	} {
+		m := hiiragi.NewMemFS()
+		for _, n := range []string{"t", "a/t", "a/x/1"} {
+			if err := m.WriteFile(filepath.Join(root, n), []byte("data\n"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.Symlink(filepath.Join("a", "x"), filepath.Join(root, "d")); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now().Truncate(time.Second)
+		sep := string(filepath.Separator)
+		for _, l := range [][]string{
+			{"a/l", ".." + sep + "t"},
+			{"b/l", "." + sep + ".." + sep + "t"},
+			{"c/l", filepath.Join(root, "t")},
+			// resolved to a/t
+			{"e/l", ".." + sep + "d" + sep + ".." + sep + "t"},
+		} {
+			n := filepath.Join(root, l[0])
+			if err := m.Symlink(l[1], n); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Chtimes(n, time.Time{}, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := dedupMemFS(t, m, "symlinks", map[string]any{
+			"normalize": tt.norm,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, n := range []string{"b/l", "c/l", "e/l"} {
+			if g, e := sameMemFile(m, filepath.Join(root, "a", "l"), filepath.Join(root, n)), tt.e[i]; g != e {
+				t.Errorf("%v: expected same(a/l, %v) = %v, got %v", tt.norm, n, e, g)
+			}
+		}
+	}
+}
+
+func TestDedupSymlinksStrategy(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	now := time.Now().Truncate(time.Second)
+	var links []string
+	for i, n := range []string{"a/l", "b/l", "c/l"} {
+		// the first one is on another device
+		m.Dev = uint64(min(i, 1) + 1)
+		n = filepath.Join(root, n)
+		if err := m.Symlink("1", n); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Lchtimes(n, time.Time{}, now); err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, n)
+	}
+	d, err := dedupMemFS(t, m, "symlinks", map[string]any{
+		"cross-device": true,
+		"strategy":     hiiragi.AbsSymlink,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := d.Summary().Linked, int64(1); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if !sameMemFile(m, links[1], links[2]) {
+		t.Error("symlinks should be same")
+	}
+	if sameMemFile(m, links[0], links[1]) {
+		t.Error("symlinks should be different")
+	}
+}
+
 func dedup(t *testing.T, action string, opts map[string]any) (list []string, err error) {
 	dir := t.TempDir()
 	root := filepath.Join(dir, "root")
@@ -703,7 +1269,7 @@ func dedup(t *testing.T, action string, opts map[string]any) (list []string, err
 	}
 	defer db.Close()
 
-	f := hiiragi.NewFinder(ui, db)
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
 	if err = f.Walk(ctx, root); err != nil {
 		return
 	}
@@ -712,7 +1278,7 @@ func dedup(t *testing.T, action string, opts map[string]any) (list []string, err
 		return
 	}
 
-	d := hiiragi.NewDeduper(ui, db)
+	d := hiiragi.NewDeduper(hiiragi.NewTerminal(ui), db)
 	if v, ok := opts["attrs"]; ok {
 		d.Attrs = v.(bool)
 	}
@@ -739,6 +1305,88 @@ func dedup(t *testing.T, action string, opts map[string]any) (list []string, err
 	return
 }
 
+func dedupMemFS(t *testing.T, m *hiiragi.MemFS, action string, opts map[string]any) (d *hiiragi.Deduper, err error) {
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	var obs hiiragi.Observer = hiiragi.NewTerminal(ui)
+	if v, ok := opts["observer"]; ok {
+		obs = v.(hiiragi.Observer)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "hiiragi.db")
+	if v, ok := opts["db"]; ok {
+		path = v.(string)
+	}
+	db, err := hiiragi.Create(path)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	if v, ok := opts["granularity"]; ok {
+		db.SetGranularity(v.(time.Duration))
+	}
+	if v, ok := opts["normalize"]; ok {
+		db.SetNormalization(v.(hiiragi.Normalize))
+	}
+	if v, ok := opts["cross-device"]; ok {
+		db.SetCrossDevice(v.(bool))
+	}
+
+	f := hiiragi.NewFinder(obs, db)
+	f.FS = m
+	if err = f.Walk(ctx, filepath.Join(string(filepath.Separator), "root")); err != nil {
+		return
+	}
+	f.Close()
+	// killed after the walk
+	if v, ok := opts["intent"]; ok {
+		if err = db.SetIntent(v.(func() *hiiragi.Intent)()); err != nil {
+			return
+		}
+	}
+
+	d = hiiragi.NewDeduper(obs, db)
+	d.FS = m
+	if v, ok := opts["attrs"]; ok {
+		d.Attrs = v.(bool)
+	}
+	if v, ok := opts["xattrs"]; ok {
+		d.Xattrs = v.(bool)
+	}
+	if v, ok := opts["ignore-xattrs"]; ok {
+		d.IgnoreXattrs = v.([]string)
+	}
+	if v, ok := opts["mtime"]; ok {
+		d.Mtime = v.(hiiragi.When)
+	}
+	if v, ok := opts["keep-mtime"]; ok {
+		d.KeepMtime = v.(hiiragi.When)
+	}
+	if v, ok := opts["keep-atime"]; ok {
+		d.KeepAtime = v.(hiiragi.When)
+	}
+	if v, ok := opts["keep-dir-times"]; ok {
+		d.KeepDirTimes = v.(bool)
+	}
+	if v, ok := opts["strategy"]; ok {
+		d.Strategy = v.(hiiragi.Strategy)
+	}
+	switch action {
+	case "all":
+		err = d.All(ctx)
+	case "files":
+		err = d.Files(ctx)
+	case "symlinks":
+		err = d.Symlinks(ctx)
+	}
+	return
+}
+
 func createFiles(root string) (files []string, err error) {
 	now := time.Now().Truncate(time.Second)
 	if err = mkdir(root); err != nil {
@@ -826,6 +1474,30 @@ func createSymlinks(path, root string) (syms []string, err error) {
 	return
 }
 
+func createMemFiles(t *testing.T) (*hiiragi.MemFS, []string) {
+	t.Helper()
+
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	now := time.Now().Truncate(time.Second)
+	var files []string
+	for _, n := range []string{"1", "a/1", "b/1"} {
+		n = filepath.Join(root, n)
+		if err := m.WriteFile(n, []byte("data\n"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Chtimes(n, time.Time{}, now); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, n)
+	}
+	// mtime is differ
+	if err := m.Chtimes(files[2], time.Time{}, now.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	return m, files
+}
+
 func mkdir(path string) error {
 	return os.MkdirAll(path, 0o777)
 }
@@ -842,6 +1514,18 @@ func sameFile(a, b string) bool {
 	return hiiragi.SameFile(fi1, fi2)
 }
 
+func sameMemFile(m *hiiragi.MemFS, a, b string) bool {
+	fi1, err := m.Lstat(a)
+	if err != nil {
+		return false
+	}
+	fi2, err := m.Lstat(b)
+	if err != nil {
+		return false
+	}
+	return hiiragi.SameFile(fi1, fi2)
+}
+
 func file(name, data string) error {
 	return os.WriteFile(name, []byte(data), 0o666)
 }
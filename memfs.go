@@ -0,0 +1,584 @@
+//
+// hiiragi :: memfs.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MemFS struct {
+	Dev  uint64
+	Hook func(op, name string) error // fault injection
+
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	ino   uint64
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		Dev:   1,
+		nodes: make(map[string]*memNode),
+	}
+}
+
+func (m *MemFS) Mkdir(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdir(filepath.Clean(name))
+}
+
+func (m *MemFS) mkdir(name string) error {
+	if n, ok := m.nodes[name]; ok {
+		if !n.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	if dir := filepath.Dir(name); dir != name {
+		if err := m.mkdir(dir); err != nil {
+			return err
+		}
+	}
+	m.ino++
+	now := time.Now()
+	m.nodes[name] = &memNode{
+		mode:  fs.ModeDir | 0o777,
+		atime: now,
+		mtime: now,
+		dev:   m.Dev,
+		ino:   m.ino,
+		nlink: 1,
+	}
+	return nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	if n, ok := m.nodes[filepath.Clean(name)]; ok && n.mode.IsRegular() {
+		// keep inode
+		n.data = data
+		n.mtime = time.Now()
+		m.mu.Unlock()
+		return nil
+	}
+	m.mu.Unlock()
+
+	return m.create(name, &memNode{
+		mode: perm.Perm(),
+		data: data,
+	})
+}
+
+func (m *MemFS) Symlink(oldname, newname string) error {
+	if err := m.hook("symlink", newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+	return m.create(newname, &memNode{
+		mode:   fs.ModeSymlink | 0o777,
+		target: oldname,
+	})
+}
+
+func (m *MemFS) create(name string, n *memNode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := m.mkdir(filepath.Dir(name)); err != nil {
+		return err
+	}
+	if o, ok := m.nodes[name]; ok && o.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	m.ino++
+	n.atime = time.Now()
+	n.mtime = n.atime
+	n.dev = m.Dev
+	n.ino = m.ino
+	n.nlink = 1
+	m.nodes[name] = n
+	m.touch(name)
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("chmod", name)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode.Type() | mode.Perm()
+	return nil
+}
+
+func (m *MemFS) Setxattr(name, attr string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("setxattr", name)
+	if err != nil {
+		return err
+	}
+	if n.xattrs == nil {
+		n.xattrs = make(map[string][]byte)
+	}
+	n.xattrs[attr] = data
+	return nil
+}
+
+func (m *MemFS) Xattrs(name string) (map[string][]byte, error) {
+	if err := m.hook("xattrs", name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("xattrs", name)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(n.xattrs), nil
+}
+
+func (m *MemFS) Label(name string) ([]byte, error) {
+	if err := m.hook("label", name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("label", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.xattrs[selinuxXattr], nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := m.hook("chtimes", name); err != nil {
+		return err
+	}
+	// follow symlinks
+	p, err := realpath(m, name)
+	if err != nil {
+		return err
+	}
+	return m.chtimes("chtimes", p, atime, mtime)
+}
+
+func (m *MemFS) Lchtimes(name string, atime, mtime time.Time) error {
+	if err := m.hook("lchtimes", name); err != nil {
+		return err
+	}
+	return m.chtimes("lchtimes", name, atime, mtime)
+}
+
+func (m *MemFS) chtimes(op, name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node(op, name)
+	if err != nil {
+		return err
+	}
+	if !atime.IsZero() {
+		n.atime = atime
+	}
+	if !mtime.IsZero() {
+		n.mtime = mtime
+	}
+	return nil
+}
+
+func (m *MemFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	root = filepath.Clean(root)
+	fi, err := m.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = m.walk(root, fs.FileInfoToDirEntry(fi), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (m *MemFS) walk(path string, de fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, de, nil); err != nil || !de.IsDir() {
+		if err == fs.SkipDir && de.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	for _, name := range m.children(path) {
+		de, err := m.entry(name)
+		if err != nil {
+			if err = fn(name, nil, err); err != nil && err != fs.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err = m.walk(name, de, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := m.hook("readdir", name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	n, err := m.node("readdir", name)
+	m.mu.Unlock()
+	switch {
+	case err != nil:
+		return nil, err
+	case !n.mode.IsDir():
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var list []fs.DirEntry
+	for _, k := range m.children(filepath.Clean(name)) {
+		if de, err := m.entry(k); err == nil {
+			list = append(list, de)
+		}
+	}
+	return list, nil
+}
+
+func (m *MemFS) entry(name string) (fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memDirEntry{
+		fs:   m,
+		path: name,
+		mode: n.mode,
+	}, nil
+}
+
+func (m *MemFS) children(path string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for k := range m.nodes {
+		if k != path && filepath.Dir(k) == path {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *MemFS) Lstat(name string) (FileInfoEx, error) {
+	if err := m.hook("lstat", name); err != nil {
+		return nil, err
+	}
+	return m.lstat(name)
+}
+
+func (m *MemFS) lstat(name string) (FileInfoEx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, err := m.node("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFileInfo{
+		name:  filepath.Base(name),
+		path:  name,
+		node:  n,
+		mode:  n.mode,
+		size:  n.size(),
+		nlink: n.nlink,
+		atime: n.atime,
+		time:  n.mtime,
+	}, nil
+}
+
+func (m *MemFS) Open(name string) (io.ReadCloser, error) {
+	if err := m.hook("open", name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, err := m.node("open", name)
+	switch {
+	case err != nil:
+		return nil, err
+	case n.mode.Type() != 0:
+		return nil, &os.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memFile{
+		fs:   m,
+		name: name,
+		node: n,
+	}, nil
+}
+
+func (m *MemFS) Link(oldname, newname string) error {
+	if err := m.hook("link", newname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldname = filepath.Clean(oldname)
+	newname = filepath.Clean(newname)
+	n, err := m.node("link", oldname)
+	switch {
+	case err != nil:
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	case n.mode.IsDir():
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrPermission}
+	}
+	if _, ok := m.nodes[newname]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	} else if _, ok := m.nodes[filepath.Dir(newname)]; !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	n.nlink++
+	m.nodes[newname] = n
+	m.touch(newname)
+	return nil
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	if err := m.hook("rename", oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath = filepath.Clean(oldpath)
+	newpath = filepath.Clean(newpath)
+	n, err := m.node("rename", oldpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	if _, ok := m.nodes[filepath.Dir(newpath)]; !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if o, ok := m.nodes[newpath]; ok {
+		if o.mode.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+		}
+		o.nlink--
+	}
+	if n.mode.IsDir() {
+		prefix := oldpath + string(filepath.Separator)
+		var list []string
+		for k := range m.nodes {
+			if strings.HasPrefix(k, prefix) {
+				list = append(list, k)
+			}
+		}
+		for _, k := range list {
+			m.nodes[filepath.Join(newpath, k[len(prefix):])] = m.nodes[k]
+			delete(m.nodes, k)
+		}
+	}
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+	m.touch(oldpath)
+	m.touch(newpath)
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	if err := m.hook("remove", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, err := m.node("remove", name)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() {
+		for k := range m.nodes {
+			if k != name && filepath.Dir(k) == name {
+				return &os.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+			}
+		}
+	}
+	n.nlink--
+	delete(m.nodes, name)
+	m.touch(name)
+	return nil
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	if err := m.hook("readlink", name); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, err := m.node("readlink", name)
+	switch {
+	case err != nil:
+		return "", err
+	case n.mode.Type() != fs.ModeSymlink:
+		return "", &os.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+func (m *MemFS) hook(op, name string) error {
+	if m.Hook != nil {
+		if err := m.Hook(op, filepath.Clean(name)); err != nil {
+			return &os.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) touch(name string) {
+	if n, ok := m.nodes[filepath.Dir(name)]; ok {
+		n.mtime = time.Now()
+	}
+}
+
+func (m *MemFS) node(op, name string) (*memNode, error) {
+	n, ok := m.nodes[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+type memNode struct {
+	mode   fs.FileMode
+	data   []byte
+	target string
+	xattrs map[string][]byte
+	atime  time.Time
+	mtime  time.Time
+	dev    uint64
+	ino    uint64
+	nlink  uint64
+}
+
+func (n *memNode) size() int64 {
+	if n.mode.Type() == fs.ModeSymlink {
+		return int64(len(n.target))
+	}
+	return int64(len(n.data))
+}
+
+type memFile struct {
+	fs   *MemFS
+	name string
+	node *memNode
+	off  int64
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	if err := f.fs.hook("read", f.name); err != nil {
+		return 0, err
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memDirEntry calls Lstat lazily like os.DirEntry.
+type memDirEntry struct {
+	fs   *MemFS
+	path string
+	mode fs.FileMode
+}
+
+func (de *memDirEntry) Name() string               { return filepath.Base(de.path) }
+func (de *memDirEntry) IsDir() bool                { return de.mode.IsDir() }
+func (de *memDirEntry) Type() fs.FileMode          { return de.mode.Type() }
+func (de *memDirEntry) Info() (fs.FileInfo, error) { return de.fs.Lstat(de.path) }
+
+type memFileInfo struct {
+	name  string
+	path  string
+	node  *memNode
+	mode  fs.FileMode
+	size  int64
+	nlink uint64
+	atime time.Time
+	time  time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.time }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() any           { return nil }
+func (fi *memFileInfo) Path() string       { return fi.path }
+func (fi *memFileInfo) Atime() time.Time   { return fi.atime }
+
+func (fi *memFileInfo) Dev() (uint64, error) {
+	return fi.node.dev, nil
+}
+
+func (fi *memFileInfo) Ino() (uint64, error) {
+	return fi.node.ino, nil
+}
+
+func (fi *memFileInfo) Nlink() (uint64, error) {
+	return fi.nlink, nil
+}
@@ -0,0 +1,108 @@
+//
+// hiiragi :: memfs_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"io"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hattya/hiiragi"
+)
+
+func TestMemFS(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for _, n := range []string{"b", "a/2", "a/1"} {
+		if err := m.WriteFile(filepath.Join(root, n), []byte("data\n"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Symlink("a/1", filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	// walk
+	var list []string
+	err := m.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		list = append(list, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := list, []string{".", "a", "a/1", "a/2", "b", "c"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// link
+	a1 := filepath.Join(root, "a", "1")
+	b := filepath.Join(root, "b")
+	if err := m.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Link(a1, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Link(a1, b); err == nil {
+		t.Error("expected error")
+	}
+	fi1, err := m.Lstat(a1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := m.Lstat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hiiragi.SameFile(fi1, fi2) {
+		t.Error("files should be same")
+	}
+	if nlink, _ := fi1.Nlink(); nlink != 2 {
+		t.Errorf("expected 2, got %v", nlink)
+	}
+	// rename
+	d := filepath.Join(root, "d")
+	if err := m.Rename(filepath.Join(root, "a"), d); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Lstat(a1); err == nil {
+		t.Error("expected error")
+	}
+	f, err := m.Open(filepath.Join(d, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := string(data), "data\n"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+	// readlink
+	switch tgt, err := m.Readlink(filepath.Join(root, "c")); {
+	case err != nil:
+		t.Fatal(err)
+	case tgt != "a/1":
+		t.Errorf("expected %q, got %q", "a/1", tgt)
+	}
+	if _, err := m.Readlink(b); err == nil {
+		t.Error("expected error")
+	}
+	// remove
+	if err := m.Remove(d); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,179 @@
+//
+// hiiragi :: meta.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ScanInfo struct {
+	Version string            `json:"version"`
+	Start   time.Time         `json:"start"`
+	End     time.Time         `json:"end"`
+	Roots   []*ScanRoot       `json:"roots"`
+	MinSize int64             `json:"min-size,omitempty"`
+	MaxSize int64             `json:"max-size,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+type ScanRoot struct {
+	Path    string   `json:"path"`
+	Exclude []string `json:"exclude,omitempty"`
+	Last    string   `json:"last,omitempty"`
+	Done    bool     `json:"done"`
+}
+
+func (si *ScanInfo) Done() bool {
+	for _, r := range si.Roots {
+		if !r.Done {
+			return false
+		}
+	}
+	return true
+}
+
+func (si *ScanInfo) Diff(o *ScanInfo) []string {
+	var list []string
+	paths := func(si *ScanInfo) []string {
+		var v []string
+		for _, r := range si.Roots {
+			v = append(v, r.Path)
+		}
+		return v
+	}
+	if a, b := paths(si), paths(o); len(b) != 0 && !slices.Equal(a, b) {
+		list = append(list, fmt.Sprintf("roots: %q != %q", a, b))
+	}
+	for _, r := range si.Roots {
+		for _, or := range o.Roots {
+			if r.Path == or.Path && !slices.Equal(r.Exclude, or.Exclude) {
+				list = append(list, fmt.Sprintf("exclude of %v: %q != %q", r.Path, r.Exclude, or.Exclude))
+			}
+		}
+	}
+	if si.MinSize != o.MinSize {
+		list = append(list, fmt.Sprintf("min-size: %v != %v", si.MinSize, o.MinSize))
+	}
+	if si.MaxSize != o.MaxSize {
+		list = append(list, fmt.Sprintf("max-size: %v != %v", si.MaxSize, o.MaxSize))
+	}
+	for _, k := range slices.Sorted(maps.Keys(o.Options)) {
+		if v, ok := si.Options[k]; ok && v != o.Options[k] {
+			list = append(list, fmt.Sprintf("%v: %v != %v", k, v, o.Options[k]))
+		}
+	}
+	return list
+}
+
+func (db *DB) ScanInfo() (*ScanInfo, error) {
+	si := new(ScanInfo)
+	switch ok, err := db.meta("scan", si); {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, nil
+	}
+	return si, nil
+}
+
+// ReadScanInfo reads the scan information of the cache without migrating or
+// modifying it.
+func ReadScanInfo(name string) (*ScanInfo, error) {
+	r := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+	db, err := sql.Open("sqlite3", "file:"+r.Replace(filepath.ToSlash(name))+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'").Scan(&n); err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	} else if n == 0 {
+		return nil, nil
+	}
+	var s string
+	switch err := db.QueryRow(`SELECT value FROM meta WHERE key = 'scan'`).Scan(&s); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	si := new(ScanInfo)
+	if err := json.Unmarshal([]byte(s), si); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+func (db *DB) SetScanInfo(si *ScanInfo) error {
+	return db.setMeta("scan", si)
+}
+
+type Intent struct {
+	PID   int      `json:"pid"`
+	Paths []string `json:"paths"`
+}
+
+func (db *DB) Intent() (*Intent, error) {
+	in := new(Intent)
+	switch ok, err := db.meta("intent", in); {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, nil
+	}
+	return in, nil
+}
+
+func (db *DB) SetIntent(in *Intent) error {
+	if in == nil {
+		return db.withTx(func() error {
+			_, err := db.scope().tx.Exec(`DELETE FROM meta WHERE key = 'intent'`)
+			return err
+		})
+	}
+	return db.setMeta("intent", in)
+}
+
+func (db *DB) meta(key string, v any) (bool, error) {
+	var s string
+	var err error
+	if sc := db.scope(); sc != nil {
+		err = sc.tx.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&s)
+	} else {
+		err = db.db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&s)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(s), v)
+}
+
+func (db *DB) setMeta(key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.withTx(func() error {
+		_, err := db.scope().tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, key, string(b))
+		return err
+	})
+}
@@ -0,0 +1,122 @@
+//
+// hiiragi :: observer.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hattya/go.cli"
+)
+
+type Observer interface {
+	OnScan(fi FileInfoEx)
+	OnGroup(list []FileInfoEx)
+	OnLink(src, dst string)
+	OnSkip(path string)
+	OnError(err error)
+	OnProgress(p Progress)
+}
+
+type Terminal struct {
+	Progress    bool
+	LogInterval time.Duration
+	LogEvery    int64
+
+	ui *cli.CLI
+
+	mu     sync.Mutex
+	src    string
+	bol    bool
+	logged time.Time
+	mark   int64
+}
+
+func NewTerminal(ui *cli.CLI) *Terminal {
+	return &Terminal{
+		Progress: true,
+		ui:       ui,
+		bol:      true,
+	}
+}
+
+func (t *Terminal) OnScan(FileInfoEx) {}
+
+func (t *Terminal) OnGroup([]FileInfoEx) {}
+
+func (t *Terminal) OnLink(src, dst string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clear()
+	if src != t.src {
+		t.ui.Println(">>", src)
+		t.src = src
+	}
+	t.ui.Println(" +", dst)
+}
+
+func (t *Terminal) OnSkip(string) {}
+
+func (t *Terminal) OnError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clear()
+	t.ui.Errorln("error:", err)
+}
+
+func (t *Terminal) OnProgress(p Progress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case p.Done:
+		switch {
+		case t.Progress:
+			t.ui.Printf("\x1b[?25h")
+		case t.logging():
+			t.log(p)
+		default:
+			t.ui.Printf("%v", p)
+			t.bol = false
+		}
+		if !t.bol {
+			t.ui.Printf("\n")
+			t.bol = true
+		}
+		t.logged = time.Time{}
+		t.mark = 0
+	case t.Progress:
+		t.ui.Printf("\r\x1b[?25l%v\x1b[K", p)
+		t.bol = false
+	case t.logging():
+		if t.logged.IsZero() || (t.LogInterval > 0 && time.Since(t.logged) >= t.LogInterval) || (t.LogEvery > 0 && t.LogEvery <= p.Pos-t.mark) {
+			t.log(p)
+		}
+	}
+}
+
+func (t *Terminal) clear() {
+	if t.Progress {
+		t.ui.Printf("\x1b[1K\r")
+	}
+	t.bol = true
+}
+
+func (t *Terminal) logging() bool {
+	return t.LogInterval > 0 || t.LogEvery > 0
+}
+
+func (t *Terminal) log(p Progress) {
+	t.logged = time.Now()
+	t.mark = p.Pos
+	t.ui.Printf("%v %v\n", t.logged.Format(time.DateTime), p)
+	t.bol = true
+}
@@ -0,0 +1,107 @@
+//
+// hiiragi :: observer_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func TestObserver(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	files, err := createFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := hiiragi.Create(filepath.Join(dir, "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := new(recorder)
+	f := hiiragi.NewFinder(r, db)
+	if err := f.Walk(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if g, e := r.scan, len(files); g != e {
+		t.Errorf("expected OnScan to be called %v times, got %v", e, g)
+	}
+
+	d := hiiragi.NewDeduper(r, db)
+	if err := d.Files(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(r.links), 2; g != e {
+		t.Errorf("expected OnLink to be called %v times, got %v", e, g)
+	}
+	if r.group == 0 {
+		t.Error("expected OnGroup to be called")
+	}
+	if g, e := r.skip, 0; g != e {
+		t.Errorf("expected OnSkip to be called %v times, got %v", e, g)
+	}
+	if g, e := r.done, 2; g != e {
+		t.Errorf("expected %v progress to be done, got %v", e, g)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	var b strings.Builder
+	ui := cli.NewCLI()
+	ui.Stdout = &b
+	ui.Stderr = &b
+
+	o := hiiragi.NewTerminal(ui)
+	o.Progress = false
+	o.OnLink("a", "b")
+	o.OnLink("a", "c")
+	o.OnLink("d", "e")
+	o.OnError(errors.New("error"))
+	if g, e := b.String(), ">> a\n + b\n + c\n>> d\n + e\nerror: error\n"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+}
+
+type recorder struct {
+	scan  int
+	group int
+	links []string
+	skip  int
+	errs  []error
+	done  int
+}
+
+func (r *recorder) OnScan(hiiragi.FileInfoEx) { r.scan++ }
+
+func (r *recorder) OnGroup([]hiiragi.FileInfoEx) { r.group++ }
+
+func (r *recorder) OnLink(src, dst string) { r.links = append(r.links, dst) }
+
+func (r *recorder) OnSkip(string) { r.skip++ }
+
+func (r *recorder) OnError(err error) { r.errs = append(r.errs, err) }
+
+func (r *recorder) OnProgress(p hiiragi.Progress) {
+	if p.Done {
+		r.done++
+	}
+}
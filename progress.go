@@ -1,7 +1,7 @@
 //
 // hiiragi :: progress.go
 //
-//   Copyright (c) 2016-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,29 +9,77 @@
 package hiiragi
 
 import (
+	"fmt"
 	"sync"
-
-	"github.com/hattya/go.cli"
+	"time"
 )
 
+type Progress struct {
+	Label   string
+	Phase   string
+	Pos     int64
+	N       int64
+	Bytes   int64
+	Size    int64
+	Elapsed time.Duration
+	Done    bool
+}
+
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+func (p Progress) ETA() time.Duration {
+	rate := p.Rate()
+	if rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(max(p.Size-p.Bytes, 0)) / rate * float64(time.Second))
+}
+
+func (p Progress) String() string {
+	label := p.Label
+	if p.Phase != "" {
+		label = fmt.Sprintf("%v (%v)", p.Label, p.Phase)
+	}
+	s := fmt.Sprintf("%v: %v", label, p.Pos)
+	if p.N > 0 {
+		s += fmt.Sprintf(" / %v", p.N)
+	}
+	if p.Size > 0 {
+		s += fmt.Sprintf(", %v / %v", formatBytes(p.Bytes), formatBytes(p.Size))
+		if p.Elapsed > 0 {
+			s += fmt.Sprintf(", %v/s", formatBytes(int64(p.Rate())))
+			if eta := p.ETA(); eta >= 0 {
+				s += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+			}
+		}
+	}
+	return s
+}
+
 type counter struct {
 	N    int64
-	Show bool
+	Size int64
 
-	ui    *cli.CLI
+	obs   Observer
 	label string
 
-	mu  sync.Mutex
-	pos int64
-	bol bool
+	mu    sync.Mutex
+	pos   int64
+	bytes int64
+	phase string
+	start time.Time
+	last  time.Time
 }
 
-func newCounter(ui *cli.CLI, label string) *counter {
+func newCounter(obs Observer, label string) *counter {
 	return &counter{
-		Show:  true,
-		ui:    ui,
+		obs:   obs,
 		label: label,
-		bol:   true,
 	}
 }
 
@@ -39,25 +87,16 @@ func (c *counter) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.Show {
-		c.ui.Printf("\x1b[?25h")
-	} else {
-		c.render()
-	}
-	if !c.bol {
-		c.ui.Printf("\n")
-		c.bol = true
-	}
+	p := c.progress()
+	p.Done = true
+	c.obs.OnProgress(p)
 }
 
-func (c *counter) Clear() {
+func (c *counter) Phase(phase string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.Show {
-		c.ui.Printf("\x1b[1K\r")
-	}
-	c.bol = true
+	c.phase = phase
 }
 
 func (c *counter) Set(i int64) {
@@ -72,17 +111,57 @@ func (c *counter) Update(i int64) {
 	defer c.mu.Unlock()
 
 	c.pos += i
-	if c.Show {
-		c.ui.Printf("\r\x1b[?25l")
-		c.render()
+	c.notify()
+}
+
+func (c *counter) Add(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.start.IsZero() {
+		c.start = time.Now()
+	}
+	c.bytes += n
+	// throttle notifications while hashing large files
+	if time.Since(c.last) >= 100*time.Millisecond {
+		c.notify()
+	}
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	c.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (c *counter) notify() {
+	c.obs.OnProgress(c.progress())
+	c.last = time.Now()
+}
+
+func (c *counter) progress() Progress {
+	p := Progress{
+		Label: c.label,
+		Phase: c.phase,
+		Pos:   c.pos,
+		N:     c.N,
+		Bytes: c.bytes,
+		Size:  c.Size,
 	}
+	if !c.start.IsZero() {
+		p.Elapsed = time.Since(c.start)
+	}
+	return p
 }
 
-func (c *counter) render() {
-	if c.N > 0 {
-		c.ui.Printf("%v: %v / %v", c.label, c.pos, c.N)
-	} else {
-		c.ui.Printf("%v: %v", c.label, c.pos)
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%v B", n)
+	}
+	v := float64(n)
+	i := -1
+	for ; v >= unit && i < 5; i++ {
+		v /= unit
 	}
-	c.bol = false
+	return fmt.Sprintf("%.1f %cB", v, "kMGTPE"[i])
 }
@@ -1,7 +1,7 @@
 //
 // hiiragi :: progress_test.go
 //
-//   Copyright (c) 2016-2025 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,6 +9,7 @@
 package hiiragi_test
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -23,7 +24,8 @@ func TestCounter(t *testing.T) {
 	ui.Stderr = &b
 
 	b.Reset()
-	c := hiiragi.NewCounter(ui, "test")
+	o := hiiragi.NewTerminal(ui)
+	c := hiiragi.NewCounter(o, "test")
 	c.N = 8
 	for range c.N {
 		c.Update(1)
@@ -34,9 +36,10 @@ func TestCounter(t *testing.T) {
 	}
 
 	b.Reset()
-	c = hiiragi.NewCounter(ui, "test")
+	o = hiiragi.NewTerminal(ui)
+	c = hiiragi.NewCounter(o, "test")
 	c.N = 8
-	c.Show = false
+	o.Progress = false
 	for range c.N {
 		c.Update(1)
 	}
@@ -46,8 +49,9 @@ func TestCounter(t *testing.T) {
 	}
 
 	b.Reset()
-	c = hiiragi.NewCounter(ui, "test")
-	c.Show = false
+	o = hiiragi.NewTerminal(ui)
+	c = hiiragi.NewCounter(o, "test")
+	o.Progress = false
 	for range 8 {
 		c.Update(1)
 	}
@@ -55,4 +59,47 @@ func TestCounter(t *testing.T) {
 	if g, e := b.String(), "test: 8\n"; g != e {
 		t.Errorf("expected %q, got %q", e, g)
 	}
+
+	b.Reset()
+	o = hiiragi.NewTerminal(ui)
+	c = hiiragi.NewCounter(o, "test")
+	c.N = 2
+	c.Size = 2500
+	o.Progress = false
+	c.Phase("hash")
+	for range c.N {
+		c.Write(make([]byte, 1250))
+		c.Update(1)
+	}
+	c.Close()
+	if g, e := b.String(), "test (hash): 2 / 2, 2.5 kB / 2.5 kB, "; !strings.HasPrefix(g, e) {
+		t.Errorf("expected prefix %q, got %q", e, g)
+	}
+	if g, e := b.String(), ", ETA 0s\n"; !strings.HasSuffix(g, e) {
+		t.Errorf("expected suffix %q, got %q", e, g)
+	}
+
+	b.Reset()
+	o = hiiragi.NewTerminal(ui)
+	c = hiiragi.NewCounter(o, "test")
+	c.N = 8
+	o.Progress = false
+	o.LogEvery = 4
+	for range c.N {
+		c.Update(1)
+	}
+	c.Close()
+	if strings.Contains(b.String(), "\x1b") {
+		t.Errorf("expected ANSI escape sequence not to be found")
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if g, e := len(lines), 3; g != e {
+		t.Fatalf("expected %v lines, got %v", e, g)
+	}
+	re := regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} test: \d / 8$`)
+	for i, pos := range []string{"1", "5", "8"} {
+		if !re.MatchString(lines[i]) || !strings.HasSuffix(lines[i], pos+" / 8") {
+			t.Errorf("unexpected line: %q", lines[i])
+		}
+	}
 }
@@ -0,0 +1,28 @@
+//
+// hiiragi :: selinux_linux.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func label(name string) ([]byte, error) {
+	b, err := buffer(func(b []byte) (int, error) { return unix.Lgetxattr(name, selinuxXattr, b) })
+	switch {
+	case errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP):
+		return nil, nil
+	case err != nil:
+		return nil, &os.PathError{Op: "lgetxattr", Path: name, Err: err}
+	}
+	return bytes.TrimRight(b, "\x00"), nil
+}
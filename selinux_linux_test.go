@@ -0,0 +1,36 @@
+//
+// hiiragi :: selinux_linux_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hattya/hiiragi"
+)
+
+func TestLabel(t *testing.T) {
+	dir := t.TempDir()
+	n := filepath.Join(dir, "1")
+	if err := touch(n); err != nil {
+		t.Fatal(err)
+	}
+	l, err := hiiragi.OSFS{}.Label(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("/sys/fs/selinux/enforce"); err != nil && l != nil {
+		t.Errorf("expected nil, got %q", l)
+	}
+	// not exist
+	if _, err := (hiiragi.OSFS{}).Label(filepath.Join(dir, "2")); err == nil {
+		t.Error("expected error")
+	}
+}
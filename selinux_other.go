@@ -0,0 +1,15 @@
+//
+// hiiragi :: selinux_other.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+//go:build !linux
+
+package hiiragi
+
+func label(string) ([]byte, error) {
+	return nil, nil
+}
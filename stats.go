@@ -0,0 +1,200 @@
+//
+// hiiragi :: stats.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hattya/go.cli"
+)
+
+type Stats struct {
+	Files        int64
+	FilesDone    int64
+	Symlinks     int64
+	SymlinksDone int64
+	Devices      []*DevStats
+	Sizes        []*SizeStats
+	Groups       int64 // size collision groups
+	GroupSize    int64
+	Savable      int64
+	Shared       int64 // entries which share inodes
+	Size         int64
+	Linked       int64 // entries which share inodes with other entries
+	Saved        int64
+	Partial      int64 // size collision groups which are partially linked
+}
+
+type DevStats struct {
+	Dev      uint64
+	Files    int64
+	Symlinks int64
+}
+
+type SizeStats struct {
+	Max   int64 // exclusive, 0 if unlimited
+	Files int64
+	Size  int64
+}
+
+func (st *Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "files:    %v / %v\n", st.FilesDone, st.Files)
+	fmt.Fprintf(&b, "symlinks: %v / %v\n", st.SymlinksDone, st.Symlinks)
+	for _, d := range st.Devices {
+		fmt.Fprintf(&b, "device %v: %v files, %v symlinks\n", d.Dev, d.Files, d.Symlinks)
+	}
+	b.WriteString("sizes:\n")
+	var lo string
+	for _, s := range st.Sizes {
+		switch s.Max {
+		case 0:
+			fmt.Fprintf(&b, "  >= %v: %v files, %v\n", lo, s.Files, formatBytes(s.Size))
+		case 1:
+			fmt.Fprintf(&b, "  empty: %v files\n", s.Files)
+		default:
+			lo = formatBytes(s.Max)
+			fmt.Fprintf(&b, "  < %v: %v files, %v\n", lo, s.Files, formatBytes(s.Size))
+		}
+	}
+	fmt.Fprintf(&b, "size collisions: %v groups, %v, %v savable\n", st.Groups, formatBytes(st.GroupSize), formatBytes(st.Savable))
+	fmt.Fprintf(&b, "shared inodes: %v entries\n", st.Shared)
+	fmt.Fprintf(&b, "hard links: %v entries, %v saved", st.Linked, formatBytes(st.Saved))
+	if st.Size > st.Saved {
+		fmt.Fprintf(&b, ", ratio %.2f", float64(st.Size)/float64(st.Size-st.Saved))
+	}
+	fmt.Fprintf(&b, "\npartially linked: %v groups of the same size (contents are not compared)", st.Partial)
+	return b.String()
+}
+
+var sizeBuckets = []int64{1, 1e3, 1e6, 1e9, 0}
+
+func (db *DB) Stats(ctx context.Context) (st *Stats, err error) {
+	st = new(Stats)
+	if st.FilesDone, st.Files, err = db.NumFiles(); err != nil {
+		return
+	}
+	if st.SymlinksDone, st.Symlinks, err = db.NumSymlinks(); err != nil {
+		return
+	}
+	// devices
+	q := cli.Dedent(`
+		SELECT i.dev,
+		       COUNT(f.id),
+		       COUNT(s.id)
+		  FROM info AS i
+		       LEFT JOIN file AS f
+		         ON f.info_id = i.id
+		       LEFT JOIN symlink AS s
+		         ON s.info_id = i.id
+		 WHERE f.id IS NOT NULL
+		    OR s.id IS NOT NULL
+		 GROUP BY i.dev
+		 ORDER BY i.dev
+	`)
+	rows, err := db.db.QueryContext(ctx, q)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := new(DevStats)
+		if err = rows.Scan(&d.Dev, &d.Files, &d.Symlinks); err != nil {
+			return
+		}
+		st.Devices = append(st.Devices, d)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	// sizes
+	var lo int64
+	for _, hi := range sizeBuckets {
+		s := &SizeStats{Max: hi}
+		q := cli.Dedent(`
+			SELECT COUNT(*),
+			       COALESCE(SUM(size), 0)
+			  FROM file
+			 WHERE ? <= size
+			   AND (? = 0 OR size < ?)
+		`)
+		if err = db.db.QueryRowContext(ctx, q, lo, hi, hi).Scan(&s.Files, &s.Size); err != nil {
+			return
+		}
+		st.Sizes = append(st.Sizes, s)
+		st.Size += s.Size
+		lo = hi
+	}
+	// size collisions
+	q = cli.Dedent(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(size * n), 0),
+		       COALESCE(SUM(size * (n - 1)), 0)
+		  FROM (
+		         SELECT f.size   AS size,
+		                COUNT(*) AS n
+		           FROM file AS f
+		                INNER JOIN info AS i
+		                   ON f.info_id = i.id
+		          GROUP BY f.size, i.dev
+		       )
+		 WHERE 1 < n
+	`)
+	if err = db.db.QueryRowContext(ctx, q).Scan(&st.Groups, &st.GroupSize, &st.Savable); err != nil {
+		return
+	}
+	// shared inodes
+	q = cli.Dedent(`
+		SELECT COUNT(*)
+		  FROM file AS f
+		       INNER JOIN info AS i
+		          ON f.info_id = i.id
+		 WHERE 1 < i.nlink
+	`)
+	if err = db.db.QueryRowContext(ctx, q).Scan(&st.Shared); err != nil {
+		return
+	}
+	// hard links
+	q = cli.Dedent(`
+		SELECT COALESCE(SUM(n), 0),
+		       COALESCE(SUM(size * (n - 1)), 0)
+		  FROM (
+		         SELECT MAX(f.size) AS size,
+		                COUNT(*)    AS n
+		           FROM file AS f
+		                INNER JOIN info AS i
+		                   ON f.info_id = i.id
+		          WHERE i.ino != 0
+		          GROUP BY i.dev, i.ino
+		       )
+		 WHERE 1 < n
+	`)
+	if err = db.db.QueryRowContext(ctx, q).Scan(&st.Linked, &st.Saved); err != nil {
+		return
+	}
+	// partially linked
+	q = cli.Dedent(`
+		SELECT COUNT(*)
+		  FROM (
+		         SELECT COUNT(*)              AS n,
+		                COUNT(DISTINCT i.ino) AS m
+		           FROM file AS f
+		                INNER JOIN info AS i
+		                   ON f.info_id = i.id
+		          WHERE i.ino != 0
+		          GROUP BY f.size, i.dev
+		       )
+		 WHERE 1 < m
+		   AND m < n
+	`)
+	err = db.db.QueryRowContext(ctx, q).Scan(&st.Partial)
+	return
+}
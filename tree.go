@@ -0,0 +1,270 @@
+//
+// hiiragi :: tree.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type DupTree struct {
+	Paths []string
+	Files int64
+	Size  int64
+}
+
+func (t *DupTree) String() string {
+	return fmt.Sprintf("%v equals %v, %v", t.Paths[0], strings.Join(t.Paths[1:], ", "), formatBytes(t.Size))
+}
+
+type TreeFinder struct {
+	FS FS
+
+	obs Observer
+	db  *DB
+	p   *counter
+}
+
+func NewTreeFinder(obs Observer, db *DB) *TreeFinder {
+	return &TreeFinder{
+		FS:  OSFS{},
+		obs: obs,
+		db:  db,
+		p:   newCounter(obs, "tree"),
+	}
+}
+
+func (tf *TreeFinder) Find(ctx context.Context) ([]*DupTree, error) {
+	defer tf.p.Close()
+
+	// directories above the roots are not scanned entirely
+	si, err := tf.db.ScanInfo()
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	if si != nil {
+		for _, r := range si.Roots {
+			roots = append(roots, filepath.Clean(r.Path))
+		}
+	}
+	below := func(path string) bool {
+		for _, r := range roots {
+			if rel, err := filepath.Rel(r, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// directories are compared by the entries in the cache
+	files, err := tf.db.ListFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files = slices.DeleteFunc(files, func(f *File) bool { return !below(filepath.Dir(f.Path)) })
+	syms, err := tf.db.ListSymlinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	syms = slices.DeleteFunc(syms, func(s *Symlink) bool { return !below(filepath.Dir(s.Path)) })
+	tf.p.N = int64(len(files))
+	// only files which have the same size can have the same hash
+	sizes := make(map[int64]int)
+	for _, f := range files {
+		sizes[f.Size]++
+	}
+	for _, f := range files {
+		if sizes[f.Size] > 1 {
+			tf.p.Size += f.Size
+		}
+	}
+
+	tf.p.Phase("hash")
+	dirs := make(map[string]*treeNode)
+	var dir func(string) *treeNode
+	dir = func(path string) *treeNode {
+		n, ok := dirs[path]
+		if !ok {
+			n = &treeNode{entries: make(map[string]string)}
+			dirs[path] = n
+			if parent := filepath.Dir(path); parent != path && below(parent) {
+				dir(parent).entries[filepath.Base(path)] = ""
+			}
+		}
+		return n
+	}
+	for _, f := range files {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		var h string
+		if sizes[f.Size] > 1 {
+			if h, err = sum(tf.FS, f.Path, tf.p); err != nil {
+				tf.obs.OnError(err)
+				// unique
+				h = "!" + f.Path
+			}
+		} else {
+			h = "!" + f.Path
+		}
+		n := dir(filepath.Dir(f.Path))
+		n.entries[filepath.Base(f.Path)] = "f" + h
+		n.files++
+		n.size += f.Size
+		tf.p.Update(1)
+	}
+	for _, s := range syms {
+		dir(filepath.Dir(s.Path)).entries[filepath.Base(s.Path)] = "l" + s.Target
+	}
+	for _, path := range slices.Collect(maps.Keys(dirs)) {
+		tf.check(dirs, path)
+	}
+
+	// children first
+	paths := make([]string, 0, len(dirs))
+	for k := range dirs {
+		paths = append(paths, k)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if a, b := depth(paths[i]), depth(paths[j]); a != b {
+			return a > b
+		}
+		return paths[i] < paths[j]
+	})
+	groups := make(map[string][]string)
+	for _, path := range paths {
+		n := dirs[path]
+		names := make([]string, 0, len(n.entries))
+		for k := range n.entries {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		h := sha256.New()
+		for _, k := range names {
+			v := n.entries[k]
+			if v == "" {
+				c := dirs[filepath.Join(path, k)]
+				v = "d" + c.digest
+				n.files += c.files
+				n.size += c.size
+			}
+			fmt.Fprintf(h, "%q %q\n", k, v)
+		}
+		if n.unique {
+			n.digest = "!" + path
+			continue
+		}
+		n.digest = hex.EncodeToString(h.Sum(nil))
+		groups[n.digest] = append(groups[n.digest], path)
+	}
+
+	var list []*DupTree
+	for _, v := range groups {
+		if len(v) < 2 || tf.nested(dirs, v) {
+			continue
+		}
+		sort.Strings(v)
+		n := dirs[v[0]]
+		if n.files == 0 {
+			// empty
+			continue
+		}
+		list = append(list, &DupTree{
+			Paths: v,
+			Files: n.files,
+			Size:  n.size,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Paths[0] < list[j].Paths[0]
+	})
+	return list, nil
+}
+
+// check marks the directory as unique if it has entries which are not in the
+// cache, such as excluded or size-filtered ones.
+func (tf *TreeFinder) check(dirs map[string]*treeNode, path string) {
+	n := dirs[path]
+	list, err := tf.FS.ReadDir(path)
+	if err != nil {
+		tf.obs.OnError(err)
+		n.unique = true
+		return
+	}
+	entries := len(n.entries)
+	seen := 0
+	for _, de := range list {
+		name := de.Name()
+		if _, ok := n.entries[name]; ok {
+			seen++
+			continue
+		}
+		if de.IsDir() {
+			// empty directory
+			p := filepath.Join(path, name)
+			if l, err := tf.FS.ReadDir(p); err == nil && len(l) == 0 {
+				n.entries[name] = ""
+				dirs[p] = &treeNode{entries: make(map[string]string)}
+				continue
+			}
+		}
+		n.unique = true
+		return
+	}
+	// removed after scanning
+	if seen != entries {
+		n.unique = true
+	}
+}
+
+func (tf *TreeFinder) nested(dirs map[string]*treeNode, paths []string) bool {
+	// reported by their parents
+	seen := make(map[string]bool)
+	var digest string
+	for _, p := range paths {
+		parent := filepath.Dir(p)
+		n, ok := dirs[parent]
+		switch {
+		case parent == p || !ok || seen[parent]:
+			return false
+		case digest == "":
+			digest = n.digest
+		case digest != n.digest:
+			return false
+		}
+		seen[parent] = true
+	}
+	return true
+}
+
+type treeNode struct {
+	entries map[string]string
+	files   int64
+	size    int64
+	digest  string
+	unique  bool
+}
+
+func depth(path string) int {
+	return strings.Count(path, string(filepath.Separator))
+}
@@ -0,0 +1,163 @@
+//
+// hiiragi :: tree_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func TestTreeFinder(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for k, v := range map[string]string{
+		"a/v1/1":        "1\n",
+		"a/v1/d/2":      "2\n",
+		"a/3":           "3\n",
+		"b/v1-copy/1":   "1\n",
+		"b/v1-copy/d/2": "2\n",
+		"b/3":           "4\n",
+		// different names
+		"c/v1/1":   "1\n",
+		"c/v1/d/x": "2\n",
+	} {
+		if err := m.WriteFile(filepath.Join(root, filepath.FromSlash(k)), []byte(v), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	if err := f.Walk(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tf := hiiragi.NewTreeFinder(hiiragi.NewTerminal(ui), db)
+	tf.FS = m
+	list, err := tf.Find(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(list), 1; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Paths, []string{filepath.Join(root, "a", "v1"), filepath.Join(root, "b", "v1-copy")}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Files, int64(2); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Size, int64(4); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestTreeFinderRoots(t *testing.T) {
+	root := string(filepath.Separator)
+	x := filepath.Join(root, "x", "data")
+	y := filepath.Join(root, "y", "data")
+	for _, tt := range []struct {
+		files map[string]string
+		paths []string
+	}{
+		// unscanned sibling
+		{
+			files: map[string]string{
+				"x/data/1":      "1\n",
+				"x/unscanned/2": "2\n",
+				"y/data/1":      "1\n",
+			},
+			paths: []string{x, y},
+		},
+		// excluded and size-filtered entries
+		{
+			files: map[string]string{
+				"x/data/v/1":     "1\n",
+				"x/data/w/1":     "2\n",
+				"x/data/w/1.tmp": "2\n",
+				"x/data/s/1":     "3\n",
+				"x/data/s/2":     "large\n",
+				"y/data/v/1":     "1\n",
+				"y/data/w/1":     "2\n",
+				"y/data/s/1":     "3\n",
+			},
+			paths: []string{filepath.Join(x, "v"), filepath.Join(y, "v")},
+		},
+	} {
+		m := hiiragi.NewMemFS()
+		for k, v := range tt.files {
+			if err := m.WriteFile(filepath.Join(root, filepath.FromSlash(k)), []byte(v), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// empty directories
+		for _, p := range []string{x, y} {
+			if err := m.Mkdir(filepath.Join(p, "e")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		ui := cli.NewCLI()
+		ui.Stdout = io.Discard
+		ui.Stderr = io.Discard
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+		f.FS = m
+		f.Exclude = []string{"*.tmp"}
+		f.MaxSize = 2
+		for _, p := range []string{x, y} {
+			if err := f.Walk(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+
+		tf := hiiragi.NewTreeFinder(hiiragi.NewTerminal(ui), db)
+		tf.FS = m
+		list, err := tf.Find(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := len(list), 1; g != e {
+			t.Fatalf("expected %v, got %v: %v", e, g, list)
+		}
+		if g, e := list[0].Paths, tt.paths; !reflect.DeepEqual(g, e) {
+			t.Errorf("expected %v, got %v", e, g)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 //
 // hiiragi :: util.go
 //
-//   Copyright (c) 2016-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,29 +9,86 @@
 package hiiragi
 
 import (
+	"bytes"
 	"crypto"
 	_ "crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-func exists(name string) bool {
-	_, err := os.Lstat(name)
+const selinuxXattr = "security.selinux"
+
+func exists(fsys FS, name string) bool {
+	_, err := fsys.Lstat(name)
 	return err == nil
 }
 
-func Sum(name string) (hash string, err error) {
-	f, err := os.Open(name)
+func realpath(fsys FS, name string) (string, error) {
+	const sep = string(filepath.Separator)
+	vol := filepath.VolumeName(name)
+	p := vol
+	if filepath.IsAbs(name) {
+		p += sep
+	}
+	rest := strings.Split(name[len(vol):], sep)
+	for n := 0; len(rest) > 0; {
+		c := rest[0]
+		rest = rest[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			p = filepath.Dir(p)
+			continue
+		}
+		q := filepath.Join(p, c)
+		fi, err := fsys.Lstat(q)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// dangling
+			return filepath.Join(append([]string{q}, rest...)...), nil
+		case err != nil:
+			return "", err
+		case fi.Mode().Type() != fs.ModeSymlink:
+			p = q
+			continue
+		}
+		if n++; n > 255 {
+			return "", &os.PathError{Op: "realpath", Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		t, err := fsys.Readlink(q)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(t) {
+			v := filepath.VolumeName(t)
+			p = v + sep
+			t = t[len(v):]
+		}
+		rest = append(strings.Split(t, sep), rest...)
+	}
+	return p, nil
+}
+
+func Sum(name string) (string, error) {
+	return sum(OSFS{}, name, io.Discard)
+}
+
+func sum(fsys FS, name string, w io.Writer) (hash string, err error) {
+	f, err := fsys.Open(name)
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
 	h := crypto.SHA256.New()
-	if _, err = io.Copy(h, f); err != nil {
+	if _, err = io.Copy(io.MultiWriter(h, w), f); err != nil {
 		return
 	}
 	hash = hex.EncodeToString(h.Sum(nil))
@@ -42,7 +99,9 @@ type FileInfoEx interface {
 	fs.FileInfo
 
 	Path() string
+	Atime() time.Time
 	Dev() (uint64, error)
+	Ino() (uint64, error)
 	Nlink() (uint64, error)
 }
 
@@ -68,8 +127,105 @@ func Stat(name string) (FileInfoEx, error) {
 	}, nil
 }
 
-func (fs *fileStatEx) ModTime() time.Time {
-	return fs.FileInfo.ModTime().Truncate(time.Second)
+func info(path string, de fs.DirEntry) (FileInfoEx, error) {
+	fi, err := de.Info()
+	if err != nil {
+		return nil, err
+	}
+	if fi, ok := fi.(FileInfoEx); ok {
+		return fi, nil
+	}
+	return &fileStatEx{
+		FileInfo: fi,
+		path:     path,
+	}, nil
+}
+
+func SameAttrs(fi1, fi2 FileInfoEx) bool {
+	if !equalAttrs(fi1, fi2, true) {
+		return false
+	}
+	ok, err := sameLabel(OSFS{}, fi1, fi2)
+	return err == nil && ok
+}
+
+func equalAttrs(fi1, fi2 FileInfoEx, dev bool) bool {
+	if dev {
+		dev1, err := fi1.Dev()
+		if err != nil {
+			return false
+		}
+		dev2, err := fi2.Dev()
+		if err != nil || dev1 != dev2 {
+			return false
+		}
+	}
+	return fi1.Mode() == fi2.Mode() && sameOwner(fi1, fi2)
+}
+
+func SameFile(fi1, fi2 FileInfoEx) bool {
+	dev1, err := fi1.Dev()
+	if err != nil {
+		return false
+	}
+	ino1, err := fi1.Ino()
+	if err != nil || ino1 == 0 {
+		return false
+	}
+	dev2, err := fi2.Dev()
+	if err != nil {
+		return false
+	}
+	ino2, err := fi2.Ino()
+	return err == nil && dev1 == dev2 && ino1 == ino2
+}
+
+func sameLabel(fsys FS, fi1, fi2 FileInfoEx) (bool, error) {
+	l1, err := fsys.Label(fi1.Path())
+	if err != nil {
+		return false, err
+	}
+	l2, err := fsys.Label(fi2.Path())
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(l1, l2), nil
+}
+
+func SameXattrs(fsys FS, fi1, fi2 FileInfoEx, ignore []string) (bool, error) {
+	x1, err := fsys.Xattrs(fi1.Path())
+	if err != nil {
+		return false, err
+	}
+	x2, err := fsys.Xattrs(fi2.Path())
+	if err != nil {
+		return false, err
+	}
+
+	skip := func(k string) bool {
+		for _, ns := range ignore {
+			if k == ns || strings.HasPrefix(k, strings.TrimSuffix(ns, ".")+".") {
+				return true
+			}
+		}
+		return false
+	}
+	n := 0
+	for k, v1 := range x1 {
+		if skip(k) {
+			continue
+		}
+		if v2, ok := x2[k]; !ok || !bytes.Equal(v1, v2) {
+			return false, nil
+		}
+		n++
+	}
+	for k := range x2 {
+		if !skip(k) {
+			n--
+		}
+	}
+	return n == 0, nil
 }
 
 func (fs *fileStatEx) Path() string {
@@ -1,7 +1,7 @@
 //
 // hiiragi :: util_test.go
 //
-//   Copyright (c) 2016-2021 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -9,8 +9,11 @@
 package hiiragi_test
 
 import (
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/hattya/hiiragi"
 )
@@ -59,6 +62,21 @@ func TestStat(t *testing.T) {
 		if !hiiragi.SameAttrs(fi1, fi2) {
 			t.Error("expected true, got false")
 		}
+		if !hiiragi.SameFile(fi1, fi2) {
+			t.Error("expected true, got false")
+		}
+		// wrapped
+		w := wrapped{fi1}
+		if !hiiragi.SameFile(w, w) {
+			t.Error("expected true, got false")
+		}
+		if !hiiragi.SameFile(w, fi2) {
+			t.Error("expected true, got false")
+		}
+		// no Sys
+		if hiiragi.SameAttrs(noSys{fi1}, fi2) {
+			t.Error("expected false, got true")
+		}
 	}
 	// not exist
 	f2 := filepath.Join(dir, "2")
@@ -69,3 +87,54 @@ func TestStat(t *testing.T) {
 		t.Error("expected error")
 	}
 }
+
+func TestLchtimes(t *testing.T) {
+	if !supportsSymlinks {
+		t.Skipf("skipping on %v", runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+	f := filepath.Join(dir, "1")
+	if err := touch(f); err != nil {
+		t.Fatal(err)
+	}
+	l := filepath.Join(dir, "2")
+	if err := os.Symlink("1", l); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := hiiragi.Lstat(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := hiiragi.Lchtimes(l, time.Time{}, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if li, err := hiiragi.Lstat(l); err != nil {
+		t.Fatal(err)
+	} else if g, e := li.ModTime(), mtime; !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// target
+	if fi2, err := hiiragi.Lstat(f); err != nil {
+		t.Fatal(err)
+	} else if g, e := fi2.ModTime(), fi.ModTime(); !g.Equal(e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	// not exist
+	if err := hiiragi.Lchtimes(filepath.Join(dir, "3"), time.Time{}, mtime); err == nil {
+		t.Error("expected error")
+	}
+}
+
+type wrapped struct {
+	hiiragi.FileInfoEx
+}
+
+type noSys struct {
+	hiiragi.FileInfoEx
+}
+
+func (noSys) Sys() any {
+	return nil
+}
@@ -1,7 +1,7 @@
 //
 // hiiragi :: util_unix.go
 //
-//   Copyright (c) 2016-2023 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -14,6 +14,7 @@ import (
 	"io/fs"
 	"os"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -22,19 +23,37 @@ func Link(oldname, newname string) error {
 	return unix.Linkat(unix.AT_FDCWD, oldname, unix.AT_FDCWD, newname, 0)
 }
 
-func SameAttrs(fi1, fi2 FileInfoEx) bool {
-	sys1 := fi1.Sys().(*syscall.Stat_t)
-	sys2 := fi2.Sys().(*syscall.Stat_t)
-	return sys1.Dev == sys2.Dev && sys1.Mode == sys2.Mode && sys1.Uid == sys2.Uid && sys1.Gid == sys2.Gid
+func Lchtimes(name string, atime, mtime time.Time) error {
+	if atime.IsZero() || mtime.IsZero() {
+		// UTIME_OMIT is not available on all platforms
+		fi, err := Lstat(name)
+		if err != nil {
+			return err
+		}
+		if atime.IsZero() {
+			atime = fi.Atime()
+		}
+		if mtime.IsZero() {
+			mtime = fi.ModTime()
+		}
+	}
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(atime.UnixNano()),
+		unix.NsecToTimespec(mtime.UnixNano()),
+	}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, name, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "lchtimes", Path: name, Err: err}
+	}
+	return nil
 }
 
-func SameFile(fi1, fi2 FileInfoEx) bool {
-	fs1, ok1 := fi1.(*fileStatEx)
-	fs2, ok2 := fi2.(*fileStatEx)
+func sameOwner(fi1, fi2 FileInfoEx) bool {
+	sys1, ok1 := fi1.Sys().(*syscall.Stat_t)
+	sys2, ok2 := fi2.Sys().(*syscall.Stat_t)
 	if !ok1 || !ok2 {
-		return false
+		return ok1 == ok2
 	}
-	return os.SameFile(fs1.FileInfo, fs2.FileInfo)
+	return sys1.Uid == sys2.Uid && sys1.Gid == sys2.Gid
 }
 
 type fileStatEx struct {
@@ -43,10 +62,18 @@ type fileStatEx struct {
 	path string
 }
 
+func (fs *fileStatEx) Atime() time.Time {
+	return atime(fs.Sys().(*syscall.Stat_t))
+}
+
 func (fs *fileStatEx) Dev() (uint64, error) {
 	return uint64(fs.Sys().(*syscall.Stat_t).Dev), nil
 }
 
+func (fs *fileStatEx) Ino() (uint64, error) {
+	return uint64(fs.Sys().(*syscall.Stat_t).Ino), nil
+}
+
 func (fs *fileStatEx) Nlink() (uint64, error) {
 	return uint64(fs.Sys().(*syscall.Stat_t).Nlink), nil
 }
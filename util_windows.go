@@ -1,7 +1,7 @@
 //
 // hiiragi :: util_windows.go
 //
-//   Copyright (c) 2016-2022 Akinori Hattori <hattya@gmail.com>
+//   Copyright (c) 2016-2026 Akinori Hattori <hattya@gmail.com>
 //
 //   SPDX-License-Identifier: MIT
 //
@@ -13,42 +13,55 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"time"
 )
 
 func Link(oldname, newname string) error {
 	return os.Link(oldname, newname)
 }
 
-func SameAttrs(fi1, fi2 FileInfoEx) bool {
-	fs1, ok1 := fi1.(*fileStatEx)
-	fs2, ok2 := fi2.(*fileStatEx)
-	if !ok1 || !ok2 {
-		return false
+func Lchtimes(name string, atime, mtime time.Time) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
 	}
-	if err := fs1.load(); err != nil {
-		return false
+	h, err := syscall.CreateFile(p, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return &os.PathError{
+			Op:   "CreateFile",
+			Path: name,
+			Err:  err,
+		}
+	}
+	defer syscall.CloseHandle(h)
+
+	// nil is left unchanged
+	var a, w *syscall.Filetime
+	if !atime.IsZero() {
+		ft := syscall.NsecToFiletime(atime.UnixNano())
+		a = &ft
 	}
-	if err := fs2.load(); err != nil {
-		return false
+	if !mtime.IsZero() {
+		ft := syscall.NsecToFiletime(mtime.UnixNano())
+		w = &ft
 	}
-	sys1 := fi1.Sys().(*syscall.Win32FileAttributeData)
-	sys2 := fi2.Sys().(*syscall.Win32FileAttributeData)
-	return fs1.vol == fs2.vol && sys1.FileAttributes == sys2.FileAttributes
+	if err := syscall.SetFileTime(h, nil, a, w); err != nil {
+		return &os.PathError{
+			Op:   "SetFileTime",
+			Path: name,
+			Err:  err,
+		}
+	}
+	return nil
 }
 
-func SameFile(fi1, fi2 FileInfoEx) bool {
-	fs1, ok1 := fi1.(*fileStatEx)
-	fs2, ok2 := fi2.(*fileStatEx)
+func sameOwner(fi1, fi2 FileInfoEx) bool {
+	sys1, ok1 := fi1.Sys().(*syscall.Win32FileAttributeData)
+	sys2, ok2 := fi2.Sys().(*syscall.Win32FileAttributeData)
 	if !ok1 || !ok2 {
-		return false
+		return ok1 == ok2
 	}
-	if err := fs1.load(); err != nil {
-		return false
-	}
-	if err := fs2.load(); err != nil {
-		return false
-	}
-	return fs1.vol == fs2.vol && fs1.idx == fs2.idx
+	return sys1.FileAttributes == sys2.FileAttributes
 }
 
 type fileStatEx struct {
@@ -97,6 +110,10 @@ func (fs *fileStatEx) load() error {
 	return nil
 }
 
+func (fs *fileStatEx) Atime() time.Time {
+	return time.Unix(0, fs.Sys().(*syscall.Win32FileAttributeData).LastAccessTime.Nanoseconds())
+}
+
 func (fs *fileStatEx) Dev() (uint64, error) {
 	if err := fs.load(); err != nil {
 		return 0, err
@@ -104,6 +121,13 @@ func (fs *fileStatEx) Dev() (uint64, error) {
 	return uint64(fs.vol), nil
 }
 
+func (fs *fileStatEx) Ino() (uint64, error) {
+	if err := fs.load(); err != nil {
+		return 0, err
+	}
+	return fs.idx, nil
+}
+
 func (fs *fileStatEx) Nlink() (uint64, error) {
 	if err := fs.load(); err != nil {
 		return 0, err
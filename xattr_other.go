@@ -0,0 +1,15 @@
+//
+// hiiragi :: xattr_other.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+//go:build !(darwin || freebsd || linux || netbsd)
+
+package hiiragi
+
+func xattrs(string) (map[string][]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+//
+// hiiragi :: xattr_unix.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+//go:build darwin || freebsd || linux || netbsd
+
+package hiiragi
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func xattrs(name string) (map[string][]byte, error) {
+	b, err := buffer(func(b []byte) (int, error) { return unix.Llistxattr(name, b) })
+	switch {
+	case errors.Is(err, unix.ENOTSUP):
+		return nil, nil
+	case err != nil:
+		return nil, &os.PathError{Op: "llistxattr", Path: name, Err: err}
+	}
+
+	m := make(map[string][]byte)
+	for _, k := range strings.Split(string(b), "\x00") {
+		if k == "" {
+			continue
+		}
+		v, err := buffer(func(b []byte) (int, error) { return unix.Lgetxattr(name, k, b) })
+		if err != nil {
+			return nil, &os.PathError{Op: "lgetxattr", Path: name, Err: err}
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func buffer(fn func([]byte) (int, error)) ([]byte, error) {
+	for {
+		n, err := fn(nil)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		b := make([]byte, n)
+		switch n, err = fn(b); {
+		case errors.Is(err, unix.ERANGE):
+			// grown
+		case err != nil:
+			return nil, err
+		default:
+			return b[:n], nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+//
+// hiiragi :: xattr_unix_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+//go:build darwin || freebsd || linux || netbsd
+
+package hiiragi_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/hattya/hiiragi"
+	"golang.org/x/sys/unix"
+)
+
+func TestSameXattrs(t *testing.T) {
+	dir := t.TempDir()
+	var files []hiiragi.FileInfoEx
+	for _, n := range []string{"1", "2"} {
+		n = filepath.Join(dir, n)
+		if err := touch(n); err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Setxattr(n, "user.test", []byte("a"), 0); err != nil {
+			if errors.Is(err, unix.ENOTSUP) {
+				t.Skip("xattrs are not supported")
+			}
+			t.Fatal(err)
+		}
+		fi, err := hiiragi.Lstat(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fi)
+	}
+
+	ok, err := hiiragi.SameXattrs(hiiragi.OSFS{}, files[0], files[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected true, got false")
+	}
+	// differ
+	if err := unix.Setxattr(files[1].Path(), "user.test", []byte("b"), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		ignore []string
+		same   bool
+	}{
+		{nil, false},
+		{[]string{"user"}, true},
+		{[]string{"user.test"}, true},
+		{[]string{"security"}, false},
+	} {
+		ok, err := hiiragi.SameXattrs(hiiragi.OSFS{}, files[0], files[1], tt.ignore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, e := ok, tt.same; g != e {
+			t.Errorf("expected %v, got %v (ignore = %v)", e, g, tt.ignore)
+		}
+	}
+	// not exist
+	if err := unix.Unlink(files[1].Path()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hiiragi.SameXattrs(hiiragi.OSFS{}, files[0], files[1], nil); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,130 @@
+//
+// hiiragi :: xdev.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type CrossDup struct {
+	Paths  []string
+	Devs   int
+	Size   int64
+	Wasted int64
+}
+
+func (d *CrossDup) String() string {
+	return fmt.Sprintf("%v equals %v on %v devices, %v wasted", d.Paths[0], strings.Join(d.Paths[1:], ", "), d.Devs, formatBytes(d.Wasted))
+}
+
+type CrossDevFinder struct {
+	FS FS
+
+	obs Observer
+	db  *DB
+	p   *counter
+}
+
+func NewCrossDevFinder(obs Observer, db *DB) *CrossDevFinder {
+	return &CrossDevFinder{
+		FS:  OSFS{},
+		obs: obs,
+		db:  db,
+		p:   newCounter(obs, "xdev"),
+	}
+}
+
+func (xf *CrossDevFinder) Find(ctx context.Context) ([]*CrossDup, error) {
+	defer xf.p.Close()
+
+	files, err := xf.db.ListFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// only files which have the same size on different devices
+	devs := make(map[int64]map[uint64]bool)
+	for _, f := range files {
+		if f.Size == 0 {
+			continue
+		}
+		if devs[f.Size] == nil {
+			devs[f.Size] = make(map[uint64]bool)
+		}
+		devs[f.Size][f.Dev] = true
+	}
+	var list []*File
+	for _, f := range files {
+		if len(devs[f.Size]) > 1 {
+			list = append(list, f)
+			xf.p.N++
+			xf.p.Size += f.Size
+		}
+	}
+
+	xf.p.Phase("hash")
+	type inode struct {
+		dev, ino uint64
+	}
+	seen := make(map[inode]string)
+	groups := make(map[string][]*File)
+	for _, f := range list {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		// hard links are hashed once
+		k := inode{f.Dev, f.Ino}
+		h, ok := seen[k]
+		if !ok || f.Ino == 0 {
+			if h, err = sum(xf.FS, f.Path, xf.p); err != nil {
+				xf.obs.OnError(err)
+				xf.p.Update(1)
+				continue
+			}
+			seen[k] = h
+		} else {
+			xf.p.Add(f.Size)
+		}
+		groups[h] = append(groups[h], f)
+		xf.p.Update(1)
+	}
+
+	var dups []*CrossDup
+	for _, v := range groups {
+		d := make(map[uint64]bool)
+		for _, f := range v {
+			d[f.Dev] = true
+		}
+		if len(d) < 2 {
+			continue
+		}
+		dup := &CrossDup{
+			Devs:   len(d),
+			Size:   v[0].Size,
+			Wasted: v[0].Size * int64(len(d)-1),
+		}
+		for _, f := range v {
+			dup.Paths = append(dup.Paths, f.Path)
+		}
+		sort.Strings(dup.Paths)
+		dups = append(dups, dup)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].Wasted != dups[j].Wasted {
+			return dups[i].Wasted > dups[j].Wasted
+		}
+		return dups[i].Paths[0] < dups[j].Paths[0]
+	})
+	return dups, nil
+}
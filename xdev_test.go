@@ -0,0 +1,83 @@
+//
+// hiiragi :: xdev_test.go
+//
+//   Copyright (c) 2026 Akinori Hattori <hattya@gmail.com>
+//
+//   SPDX-License-Identifier: MIT
+//
+
+package hiiragi_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hattya/go.cli"
+	"github.com/hattya/hiiragi"
+)
+
+func TestCrossDevFinder(t *testing.T) {
+	m := hiiragi.NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "root")
+	for _, v := range []struct {
+		dev  uint64
+		name string
+		data string
+	}{
+		{1, "a/1", "data\n"},
+		{1, "a/2", "data\n"},
+		{1, "a/3", "1234\n"},
+		{2, "b/1", "data\n"},
+		{2, "b/3", "hrg\n"},
+		// same device
+		{2, "b/4", "4321\n"},
+		{2, "b/5", "4321\n"},
+	} {
+		m.Dev = v.dev
+		if err := m.WriteFile(filepath.Join(root, filepath.FromSlash(v.name)), []byte(v.data), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := hiiragi.Create(filepath.Join(t.TempDir(), "hiiragi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ui := cli.NewCLI()
+	ui.Stdout = io.Discard
+	ui.Stderr = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := hiiragi.NewFinder(hiiragi.NewTerminal(ui), db)
+	f.FS = m
+	if err := f.Walk(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	xf := hiiragi.NewCrossDevFinder(hiiragi.NewTerminal(ui), db)
+	xf.FS = m
+	list, err := xf.Find(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(list), 1; g != e {
+		t.Fatalf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Paths, []string{filepath.Join(root, "a", "1"), filepath.Join(root, "a", "2"), filepath.Join(root, "b", "1")}; !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Devs, 2; g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+	if g, e := list[0].Wasted, int64(5); g != e {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}